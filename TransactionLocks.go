@@ -1,19 +1,73 @@
 package main
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// errLockTimeout is the cause of the lock requests that waited for longer
+// than the lock timeout.
+var errLockTimeout = errors.New("lock timeout")
+
 type TransactionLock struct {
 	mutex *TrackableRWMutex
 }
 
 type TransactionLocks struct {
-	readLockedKeys  map[Key]*TrackableRWMutex
-	writeLockedKeys map[Key]*TrackableRWMutex
+	table             *Table
+	readLockedKeys    map[Key]*TrackableRWMutex
+	writeLockedKeys   map[Key]*TrackableRWMutex
+	readLockedRanges  map[keyRange]*TrackableRWMutex
+	writeLockedRanges map[keyRange]*TrackableRWMutex
+	tableLockLevel    LockLevel
+	ctx               context.Context
+	lockTimeout       time.Duration
 }
 
-func NewTransactionLocks() *TransactionLocks {
+func NewTransactionLocks(table *Table) *TransactionLocks {
 	return &TransactionLocks{
-		readLockedKeys:  make(map[Key]*TrackableRWMutex),
-		writeLockedKeys: make(map[Key]*TrackableRWMutex),
+		table:             table,
+		readLockedKeys:    make(map[Key]*TrackableRWMutex),
+		writeLockedKeys:   make(map[Key]*TrackableRWMutex),
+		readLockedRanges:  make(map[keyRange]*TrackableRWMutex),
+		writeLockedRanges: make(map[keyRange]*TrackableRWMutex),
+		tableLockLevel:    EmptyLockLevel,
+		ctx:               context.Background(),
+		lockTimeout:       0,
+	}
+}
+
+// SetContext makes the lock requests of the transaction give up waiting once
+// ctx is done.
+func (t *TransactionLocks) SetContext(ctx context.Context) {
+	t.ctx = ctx
+}
+
+// SetLockTimeout makes every lock request of the transaction give up with a
+// LockTimeoutError once it waited for longer than timeout, like the
+// lock_timeout of Postgres. Zero waits forever.
+func (t *TransactionLocks) SetLockTimeout(timeout time.Duration) {
+	t.lockTimeout = timeout
+}
+
+// acquireMutex acquires mutex within the context and lock timeout of the
+// transaction, what names the key or range it locks in a timeout error.
+func (t *TransactionLocks) acquireMutex(txId TransactionId, mutex *TrackableRWMutex, lockLevel LockLevel, what Key) error {
+	ctx := t.ctx
+	if t.lockTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, t.lockTimeout, errLockTimeout)
+		defer cancel()
 	}
+
+	_, err := t.table.LockManager.AcquireContext(ctx, txId, mutex, lockLevel)
+	if errors.Is(err, errLockTimeout) {
+		return &LockTimeoutError{TxId: txId, Key: what}
+	}
+
+	return err
 }
 
 type LockLevel int
@@ -22,65 +76,338 @@ const (
 	EmptyLockLevel LockLevel = iota
 	Read
 	ReadWrite
+	// IntentionShared, IntentionExclusive and SharedIntentionExclusive are
+	// only taken on the table, announcing read and write locks on its rows.
+	IntentionShared
+	IntentionExclusive
+	SharedIntentionExclusive
+)
+
+// LockStrength is the lock an explicit lock takes, like SELECT ... FOR UPDATE
+// or FOR SHARE.
+type LockStrength int
+
+const (
+	ForUpdate LockStrength = iota
+	ForShare
 )
 
-func (t *TransactionLocks) Lock(lockType LockLevel, txId TransactionId, row *Row) bool {
+// LockWaitPolicy tells what an explicit lock does when another transaction
+// holds a conflicting lock: wait for it, fail right away like NOWAIT, or skip
+// the row like SKIP LOCKED.
+type LockWaitPolicy int
+
+const (
+	Wait LockWaitPolicy = iota
+	NoWait
+	SkipLocked
+)
+
+// LockMode is how an explicit lock locks a row, the zero value locks it for
+// update, waiting if needed.
+type LockMode struct {
+	Strength   LockStrength
+	WaitPolicy LockWaitPolicy
+}
+
+func (m LockMode) String() string {
+	res := "for update"
+	if m.Strength == ForShare {
+		res = "for share"
+	}
+
+	switch m.WaitPolicy {
+	case NoWait:
+		res += " nowait"
+	case SkipLocked:
+		res += " skip locked"
+	}
+
+	return res
+}
+
+func (m LockMode) lockLevel() LockLevel {
+	if m.Strength == ForShare {
+		return Read
+	}
+
+	return ReadWrite
+}
+
+func (l LockLevel) String() string {
+	switch l {
+	case EmptyLockLevel:
+		return "none"
+	case Read:
+		return "read"
+	case ReadWrite:
+		return "write"
+	case IntentionShared:
+		return "intention shared"
+	case IntentionExclusive:
+		return "intention exclusive"
+	case SharedIntentionExclusive:
+		return "shared intention exclusive"
+	default:
+		return fmt.Sprintf("LockLevel(%d)", int(l))
+	}
+}
+
+// intention returns the lock level a transaction needs on the table before
+// locking one of its rows at l.
+func (l LockLevel) intention() LockLevel {
+	if l == ReadWrite {
+		return IntentionExclusive
+	}
+
+	return IntentionShared
+}
+
+func (t *TransactionLocks) Lock(lockType LockLevel, txId TransactionId, row *Row) (bool, error) {
 	_, isReadLocked := t.readLockedKeys[row.Key]
 	_, isWriteLocked := t.writeLockedKeys[row.Key]
 
-	if isWriteLocked {
-		return false
+	if isWriteLocked || covers(t.tableLockLevel, lockType) {
+		return false, nil
+	}
+
+	if lockType == Read && isReadLocked {
+		return false, nil
+	}
+
+	if err := t.LockTable(txId, lockType.intention()); err != nil {
+		return false, err
 	}
 
 	if lockType == Read {
-		if isReadLocked {
-			return false
+		if err := t.acquire(txId, row, Read); err != nil {
+			return false, err
 		}
-
-		row.Lock.RLock()
 		t.readLockedKeys[row.Key] = row.Lock
 
-		return true
+		return true, t.escalate(txId)
+	}
+
+	// upgrading keeps the read lock until the write lock is granted
+	if err := t.acquire(txId, row, ReadWrite); err != nil {
+		return false, err
+	}
+	delete(t.readLockedKeys, row.Key)
+	t.writeLockedKeys[row.Key] = row.Lock
+
+	return true, t.escalate(txId)
+}
+
+// LockTable locks the whole table at lockLevel, like LOCK TABLE, converting
+// the lock the transaction already holds on it if needed. Every row lock
+// takes an intention lock on the table first, so a read lock on the table
+// keeps other transactions from writing any row and a write lock from
+// reading any row. The table lock is only released by UnlockAll.
+func (t *TransactionLocks) LockTable(txId TransactionId, lockLevel LockLevel) error {
+	if covers(t.tableLockLevel, lockLevel) {
+		return nil
 	}
 
-	isUpgradingLock := lockType == ReadWrite && isReadLocked
-	if isUpgradingLock {
-		row.Lock.RUnlock()
+	if err := t.acquireMutex(txId, t.table.lock, lockLevel, "table"); err != nil {
+		return err
+	}
+	t.tableLockLevel = supremum(t.tableLockLevel, lockLevel)
+
+	return nil
+}
+
+// tryLockTable is LockTable without waiting, it reports whether the table is
+// locked.
+func (t *TransactionLocks) tryLockTable(txId TransactionId, lockLevel LockLevel) (bool, error) {
+	if covers(t.tableLockLevel, lockLevel) {
+		return true, nil
+	}
+
+	isGranted, err := t.table.LockManager.TryAcquire(txId, t.table.lock, lockLevel)
+	if err != nil || !isGranted {
+		return false, err
+	}
+	t.tableLockLevel = supremum(t.tableLockLevel, lockLevel)
+
+	return true, nil
+}
+
+// HoldsTable tells whether the transaction holds the lock of the table at
+// lockLevel or a stronger one.
+func (t *TransactionLocks) HoldsTable(lockLevel LockLevel) bool {
+	return covers(t.tableLockLevel, lockLevel)
+}
+
+// escalate trades the row locks of the transaction for a read or write lock
+// on the table once it holds more of them than the table allows. Escalating
+// never waits, while other transactions hold conflicting locks on the table
+// the transaction keeps its row locks and tries again on its next one.
+func (t *TransactionLocks) escalate(txId TransactionId) error {
+	threshold := t.table.LockEscalationThreshold
+	if threshold == 0 || len(t.readLockedKeys)+len(t.writeLockedKeys) <= threshold {
+		return nil
+	}
+
+	lockLevel := Read
+	if len(t.writeLockedKeys) > 0 {
+		lockLevel = ReadWrite
+	}
+
+	isGranted, err := t.tryLockTable(txId, lockLevel)
+	if err != nil || !isGranted {
+		return err
+	}
+
+	for key, mutex := range t.readLockedKeys {
+		t.table.LockManager.Release(txId, mutex, Read)
+		delete(t.readLockedKeys, key)
+	}
+
+	for key, mutex := range t.writeLockedKeys {
+		t.table.LockManager.Release(txId, mutex, ReadWrite)
+		delete(t.writeLockedKeys, key)
+	}
+
+	return nil
+}
+
+func (t *TransactionLocks) acquire(txId TransactionId, row *Row, lockLevel LockLevel) error {
+	return t.acquireMutex(txId, row.Lock, lockLevel, row.Key)
+}
+
+// LockWith locks row as mode asks and reports whether the row is locked. It
+// is not when mode skips locked rows and another transaction holds a
+// conflicting lock, with NOWAIT that is a LockNotAvailableError instead.
+func (t *TransactionLocks) LockWith(mode LockMode, txId TransactionId, row *Row) (bool, error) {
+	lockLevel := mode.lockLevel()
+
+	if mode.WaitPolicy == Wait {
+		if _, err := t.Lock(lockLevel, txId, row); err != nil {
+			return false, err
+		}
+
+		return true, nil
+	}
+
+	if t.Holds(lockLevel, row.Key) {
+		return true, nil
+	}
+
+	isGranted, err := t.tryLockTable(txId, lockLevel.intention())
+	if err == nil && isGranted {
+		isGranted, err = t.table.LockManager.TryAcquire(txId, row.Lock, lockLevel)
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	if !isGranted && mode.WaitPolicy == NoWait {
+		return false, &LockNotAvailableError{TxId: txId, Key: row.Key}
+	}
+
+	if !isGranted {
+		return false, nil
+	}
+
+	if lockLevel == ReadWrite {
 		delete(t.readLockedKeys, row.Key)
+		t.writeLockedKeys[row.Key] = row.Lock
+	} else {
+		t.readLockedKeys[row.Key] = row.Lock
 	}
 
-	row.Lock.LockFor(txId)
-	t.writeLockedKeys[row.Key] = row.Lock
+	return true, t.escalate(txId)
+}
+
+// LockRange locks the range of keys from from to to, both included, including
+// the keys that do not exist yet. It keeps other transactions from inserting
+// into the range, the rows already in it still have to be locked one by one.
+func (t *TransactionLocks) LockRange(txId TransactionId, from Key, to Key) error {
+	keyRange := keyRange{from: from, to: to}
 
-	return true
+	if _, isReadLocked := t.readLockedRanges[keyRange]; isReadLocked || t.HoldsTable(Read) {
+		return nil
+	}
+
+	if err := t.LockTable(txId, IntentionShared); err != nil {
+		return err
+	}
+
+	mutex := t.table.rangeLock(keyRange)
+	if err := t.acquireRange(txId, keyRange, mutex, Read); err != nil {
+		return err
+	}
+	t.readLockedRanges[keyRange] = mutex
+
+	return nil
 }
 
-func (t *TransactionLocks) Unlock(row *Row) {
+// LockInsert write locks every locked range key falls into before key is
+// inserted, so the insert waits for the transactions that locked those
+// ranges to finish. Inserts into the same range wait for each other too.
+func (t *TransactionLocks) LockInsert(txId TransactionId, key Key) error {
+	if t.HoldsTable(ReadWrite) {
+		return nil
+	}
+
+	if err := t.LockTable(txId, IntentionExclusive); err != nil {
+		return err
+	}
+
+	for _, keyRange := range t.table.rangesCovering(key) {
+		if _, isWriteLocked := t.writeLockedRanges[keyRange]; isWriteLocked {
+			continue
+		}
+
+		mutex := t.table.rangeLock(keyRange)
+		if err := t.acquireRange(txId, keyRange, mutex, ReadWrite); err != nil {
+			return err
+		}
+		t.writeLockedRanges[keyRange] = mutex
+	}
+
+	return nil
+}
+
+func (t *TransactionLocks) acquireRange(txId TransactionId, keyRange keyRange, mutex *TrackableRWMutex, lockLevel LockLevel) error {
+	return t.acquireMutex(txId, mutex, lockLevel, Key(fmt.Sprintf("%v..%v", keyRange.from, keyRange.to)))
+}
+
+func (t *TransactionLocks) Unlock(txId TransactionId, row *Row) {
 	_, isReadLocked := t.readLockedKeys[row.Key]
 
 	if isReadLocked {
-		row.Lock.RUnlock()
+		t.table.LockManager.Release(txId, row.Lock, Read)
 		delete(t.readLockedKeys, row.Key)
 		return
 	}
 
 	_, isWriteLocked := t.writeLockedKeys[row.Key]
 	if isWriteLocked {
-		row.Lock.Unlock()
+		t.table.LockManager.Release(txId, row.Lock, ReadWrite)
 		delete(t.writeLockedKeys, row.Key)
 	}
 }
 
-func (t *TransactionLocks) UnlockAll() {
-	for key, mutex := range t.readLockedKeys {
-		mutex.RUnlock()
-		delete(t.readLockedKeys, key)
-	}
+// TakeWound returns the error of the wound an older transaction gave this one
+// under WoundWait since its last lock request, if any. The transaction must
+// abort instead of committing, its commit would otherwise let it escape the
+// wound while the older transaction waits for its locks.
+func (t *TransactionLocks) TakeWound(txId TransactionId) error {
+	return t.table.LockManager.TakeWound(txId)
+}
 
-	for key, mutex := range t.writeLockedKeys {
-		mutex.Unlock()
-		delete(t.writeLockedKeys, key)
+func (t *TransactionLocks) UnlockAll(txId TransactionId) {
+	t.UnlockReads(txId)
+	t.UnlockWrites(txId)
+
+	if t.tableLockLevel != EmptyLockLevel {
+		t.table.LockManager.Release(txId, t.table.lock, t.tableLockLevel)
+		t.tableLockLevel = EmptyLockLevel
 	}
+
+	t.table.LockManager.Forget(txId)
 }
 
 func (t *TransactionLocks) GetLockLevels() map[Key]LockLevel {
@@ -96,3 +423,55 @@ func (t *TransactionLocks) GetLockLevels() map[Key]LockLevel {
 
 	return result
 }
+
+// UnlockReads releases the read locks of keys and ranges, keeping the write
+// locks.
+func (t *TransactionLocks) UnlockReads(txId TransactionId) {
+	for key, mutex := range t.readLockedKeys {
+		t.table.LockManager.Release(txId, mutex, Read)
+		delete(t.readLockedKeys, key)
+	}
+
+	for keyRange, mutex := range t.readLockedRanges {
+		t.table.LockManager.Release(txId, mutex, Read)
+		delete(t.readLockedRanges, keyRange)
+	}
+}
+
+// UnlockWrites releases the write locks of keys and ranges, keeping the read
+// locks.
+func (t *TransactionLocks) UnlockWrites(txId TransactionId) {
+	for key, mutex := range t.writeLockedKeys {
+		t.table.LockManager.Release(txId, mutex, ReadWrite)
+		delete(t.writeLockedKeys, key)
+	}
+
+	for keyRange, mutex := range t.writeLockedRanges {
+		t.table.LockManager.Release(txId, mutex, ReadWrite)
+		delete(t.writeLockedRanges, keyRange)
+	}
+}
+
+// Holds tells whether the transaction holds the lock of key at lockLevel, a
+// write lock also counts as a read lock and so does a lock on the table
+// covering the row.
+func (t *TransactionLocks) Holds(lockLevel LockLevel, key Key) bool {
+	if t.HoldsTable(lockLevel) {
+		return true
+	}
+
+	if _, isWriteLocked := t.writeLockedKeys[key]; isWriteLocked {
+		return true
+	}
+
+	_, isReadLocked := t.readLockedKeys[key]
+
+	return isReadLocked && lockLevel == Read
+}
+
+// HoldsRange tells whether the transaction locked the range of keys from
+// from to to, or the whole table.
+func (t *TransactionLocks) HoldsRange(from Key, to Key) bool {
+	_, isReadLocked := t.readLockedRanges[keyRange{from: from, to: to}]
+	return isReadLocked || t.HoldsTable(Read)
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Phenomenon is one of the anomalies of Adya's isolation level definitions.
+type Phenomenon int
+
+const (
+	G0 Phenomenon = iota
+	G1a
+	G1b
+	G1c
+	GSingle
+	G2
+)
+
+func (p Phenomenon) String() string {
+	switch p {
+	case G0:
+		return "G0"
+	case G1a:
+		return "G1a"
+	case G1b:
+		return "G1b"
+	case G1c:
+		return "G1c"
+	case GSingle:
+		return "G-single"
+	case G2:
+		return "G2"
+	default:
+		return fmt.Sprintf("Phenomenon(%d)", int(p))
+	}
+}
+
+func (p Phenomenon) Name() string {
+	switch p {
+	case G0:
+		return "dirty write"
+	case G1a:
+		return "aborted read"
+	case G1b:
+		return "intermediate read"
+	case G1c:
+		return "circular information flow"
+	case GSingle:
+		return "read skew"
+	case G2:
+		return "write skew"
+	default:
+		return p.String()
+	}
+}
+
+// Anomaly is a phenomenon found in a history along with its witness, either
+// a cycle of the direct serialization graph or the read that observed a
+// value it should not have.
+type Anomaly struct {
+	Phenomenon Phenomenon
+	Cycle      []Conflict
+	Read       *HistoryOperation
+	Writer     TransactionId
+}
+
+func (a Anomaly) String() string {
+	if a.Read != nil {
+		return fmt.Sprintf("%v (%v): %v read %v = %v written by %v", a.Phenomenon, a.Phenomenon.Name(), a.Read.TxId, a.Read.Key, a.Read.Value, a.Writer)
+	}
+
+	var cycle strings.Builder
+	cycle.WriteString(string(a.Cycle[0].From))
+
+	for _, conflict := range a.Cycle {
+		fmt.Fprintf(&cycle, " -%v(%v)-> %v", conflict.Type, conflict.Key, conflict.To)
+	}
+
+	return fmt.Sprintf("%v (%v): %v", a.Phenomenon, a.Phenomenon.Name(), cycle.String())
+}
+
+// Transactions returns the transactions taking part in the anomaly, in the
+// order they appear in the witness.
+func (a Anomaly) Transactions() []TransactionId {
+	res := make([]TransactionId, 0)
+
+	if a.Read != nil {
+		return append(res, a.Writer, a.Read.TxId)
+	}
+
+	for _, conflict := range a.Cycle {
+		if !slices.Contains(res, conflict.From) {
+			res = append(res, conflict.From)
+		}
+	}
+
+	return res
+}
+
+// versionWrite is a write operation along with its position in the history.
+type versionWrite struct {
+	position  int
+	operation HistoryOperation
+}
+
+// versionInstall is the version of a key a committed transaction installed,
+// at the position in the history where it did so.
+type versionInstall struct {
+	txId      TransactionId
+	versionTs int
+	position  int
+}
+
+// Classify names every phenomenon of Adya's taxonomy present in the history,
+// at most one anomaly per phenomenon. The version order of a key is the
+// order in which the transactions writing it committed, as that is when
+// Table.SetCommitted installs their values. Multi-version timestamp ordering
+// installs its versions in the order of their write timestamps instead, which
+// its commits record as VersionTs, and read uncommitted installs them as it
+// writes, which its writes record as InstalledOnWrite. A read is assumed to
+// observe the latest earlier write of the value it returned, or the initial
+// version if there is none. A scan reads every key of its range, so a row
+// inserted into the range behind its back makes a phantom.
+//
+// As in Adya's definitions the phenomena overlap, a G0 cycle is also a G1c
+// one and a G-single cycle is also a G2 one. Only writes installed as they
+// are made can order two keys differently, so G0 takes transactions
+// overwriting each other's uncommitted writes under read uncommitted.
+func (h *History) Classify() []Anomaly {
+	graph := h.dependencyGraph()
+	edges := graph.edges
+	anomalies := make([]Anomaly, 0)
+
+	if cycle, ok := findCycleThrough(edges, []DependencyType{WWDependency}, []DependencyType{WWDependency}); ok {
+		anomalies = append(anomalies, Anomaly{Phenomenon: G0, Cycle: cycle})
+	}
+
+	if graph.abortedRead != nil {
+		anomalies = append(anomalies, *graph.abortedRead)
+	}
+
+	if graph.intermediateRead != nil {
+		anomalies = append(anomalies, *graph.intermediateRead)
+	}
+
+	dependencies := []DependencyType{WWDependency, WRDependency}
+	if cycle, ok := findCycleThrough(edges, []DependencyType{WRDependency}, dependencies); ok {
+		anomalies = append(anomalies, Anomaly{Phenomenon: G1c, Cycle: cycle})
+	} else if cycle, ok := findCycleThrough(edges, []DependencyType{WWDependency}, dependencies); ok {
+		anomalies = append(anomalies, Anomaly{Phenomenon: G1c, Cycle: cycle})
+	}
+
+	if cycle, ok := findCycleThrough(edges, []DependencyType{RWDependency}, dependencies); ok {
+		anomalies = append(anomalies, Anomaly{Phenomenon: GSingle, Cycle: cycle})
+	}
+
+	all := []DependencyType{WWDependency, WRDependency, RWDependency}
+	if cycle, ok := findCycleThrough(edges, []DependencyType{RWDependency}, all); ok {
+		anomalies = append(anomalies, Anomaly{Phenomenon: G2, Cycle: cycle})
+	}
+
+	return anomalies
+}
+
+// dependencyGraph is the direct serialization graph of the committed
+// transactions of a history, along with the first aborted and intermediate
+// reads found while building it.
+type dependencyGraph struct {
+	edges            []Conflict
+	abortedRead      *Anomaly
+	intermediateRead *Anomaly
+}
+
+// dependencyGraph builds the graph of the history from its version order and
+// from the writes its reads observed, as described on Classify.
+func (h *History) dependencyGraph() dependencyGraph {
+	operations := h.itemOperations()
+	committed := h.CommittedTransactions()
+	isCommitted := func(txId TransactionId) bool { return slices.Contains(committed, txId) }
+
+	finalWrites := make(map[TransactionId]map[Key]int)
+	versions := make(map[Key][]TransactionId)
+
+	for i, operation := range operations {
+		if operation.OperationType != WriteOperation {
+			continue
+		}
+
+		if _, ok := finalWrites[operation.TxId]; !ok {
+			finalWrites[operation.TxId] = make(map[Key]int)
+		}
+		finalWrites[operation.TxId][operation.Key] = i
+	}
+
+	installs := make(map[Key][]versionInstall)
+	for i, operation := range operations {
+		if operation.OperationType != Commit || !isCommitted(operation.TxId) {
+			continue
+		}
+
+		for key, position := range finalWrites[operation.TxId] {
+			if !operations[position].InstalledOnWrite {
+				position = i
+			}
+
+			installs[key] = append(installs[key], versionInstall{txId: operation.TxId, versionTs: operation.VersionTs, position: position})
+		}
+	}
+
+	for key, keyInstalls := range installs {
+		slices.SortStableFunc(keyInstalls, func(a, b versionInstall) int {
+			return cmp.Or(cmp.Compare(a.versionTs, b.versionTs), cmp.Compare(a.position, b.position))
+		})
+
+		for _, install := range keyInstalls {
+			if !slices.Contains(versions[key], install.txId) {
+				versions[key] = append(versions[key], install.txId)
+			}
+		}
+	}
+
+	edges := make([]Conflict, 0)
+	addEdge := func(conflict Conflict) {
+		if conflict.From != conflict.To && !slices.Contains(edges, conflict) {
+			edges = append(edges, conflict)
+		}
+	}
+
+	keys := make([]Key, 0)
+	for key := range versions {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		for i := 1; i < len(versions[key]); i++ {
+			addEdge(Conflict{From: versions[key][i-1], To: versions[key][i], Type: WWDependency, Key: key})
+		}
+	}
+
+	var abortedRead, intermediateRead *Anomaly
+
+	for i, operation := range operations {
+		if operation.OperationType != ReadOperation || !isCommitted(operation.TxId) {
+			continue
+		}
+
+		write, ok := observedWrite(operations, i)
+		if ok && write.operation.TxId == operation.TxId {
+			continue
+		}
+
+		read := operation
+		writer := EmptyTransactionId()
+
+		if ok {
+			writer = write.operation.TxId
+
+			switch {
+			case !isCommitted(writer) && abortedRead == nil:
+				abortedRead = &Anomaly{Phenomenon: G1a, Read: &read, Writer: writer}
+			case finalWrites[writer][read.Key] != write.position && intermediateRead == nil:
+				intermediateRead = &Anomaly{Phenomenon: G1b, Read: &read, Writer: writer}
+			}
+
+			if !isCommitted(writer) {
+				continue
+			}
+
+			addEdge(Conflict{From: writer, To: read.TxId, Type: WRDependency, Key: read.Key})
+		}
+
+		next := nextVersion(versions[read.Key], writer)
+		if next != EmptyTransactionId() {
+			addEdge(Conflict{From: read.TxId, To: next, Type: RWDependency, Key: read.Key})
+		}
+	}
+
+	return dependencyGraph{edges: edges, abortedRead: abortedRead, intermediateRead: intermediateRead}
+}
+
+// observedWrite finds the write the read at position observed.
+func observedWrite(operations []HistoryOperation, position int) (versionWrite, bool) {
+	read := operations[position]
+
+	for i := position - 1; i >= 0; i-- {
+		operation := operations[i]
+		if operation.OperationType != WriteOperation || operation.Key != read.Key {
+			continue
+		}
+
+		isDeleteObserved := read.Value == EmptyValue() && operation.Value == TombstoneValue()
+		if operation.TxId == read.TxId || operation.Value == read.Value || isDeleteObserved {
+			return versionWrite{position: i, operation: operation}, true
+		}
+	}
+
+	return versionWrite{}, false
+}
+
+// nextVersion returns the transaction installing the version of a key after
+// the one of writer, EmptyTransactionId() standing for the initial version.
+func nextVersion(versions []TransactionId, writer TransactionId) TransactionId {
+	if writer == EmptyTransactionId() {
+		if len(versions) == 0 {
+			return EmptyTransactionId()
+		}
+
+		return versions[0]
+	}
+
+	i := slices.Index(versions, writer)
+	if i < 0 || i+1 >= len(versions) {
+		return EmptyTransactionId()
+	}
+
+	return versions[i+1]
+}
+
+// findCycleThrough looks for a cycle starting with an edge of one of the
+// first types and going on with edges of the allowed types only.
+func findCycleThrough(edges []Conflict, first []DependencyType, allowed []DependencyType) ([]Conflict, bool) {
+	for _, start := range edges {
+		if !slices.Contains(first, start.Type) {
+			continue
+		}
+
+		if path, ok := findPath(edges, start.To, start.From, allowed, []TransactionId{start.To}); ok {
+			return append([]Conflict{start}, path...), true
+		}
+	}
+
+	return nil, false
+}
+
+func findPath(edges []Conflict, from, to TransactionId, allowed []DependencyType, visited []TransactionId) ([]Conflict, bool) {
+	if from == to {
+		return []Conflict{}, true
+	}
+
+	for _, edge := range edges {
+		if edge.From != from || !slices.Contains(allowed, edge.Type) || slices.Contains(visited, edge.To) {
+			continue
+		}
+
+		if path, ok := findPath(edges, edge.To, to, allowed, append(visited, edge.To)); ok {
+			return append([]Conflict{edge}, path...), true
+		}
+	}
+
+	return nil, false
+}
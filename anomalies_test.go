@@ -0,0 +1,198 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func phenomena(anomalies []Anomaly) []Phenomenon {
+	res := make([]Phenomenon, 0)
+
+	for _, anomaly := range anomalies {
+		res = append(res, anomaly.Phenomenon)
+	}
+
+	return res
+}
+
+func classify(t *testing.T, initial map[Key]Value, events []Event) []Anomaly {
+	table := NewTable()
+	for key, value := range initial {
+		table.Data[key] = NewRow(key, value)
+	}
+	table.History = NewHistory()
+
+	if _, err := PlayEvents(events, &table); err != nil {
+		t.Fatalf("expected PlayEvents to succeed, got error: %v", err)
+	}
+
+	return table.History.Classify()
+}
+
+func TestClassifyDirtyWrite(t *testing.T) {
+	anomalies := classify(t, map[Key]Value{"x": "0", "y": "0"}, []Event{
+		NewWrite("t1", ReadUncommittedLevel, "x", "1"),
+		NewWrite("t2", ReadUncommittedLevel, "x", "2"),
+		NewWrite("t2", ReadUncommittedLevel, "y", "2"),
+		NewWrite("t1", ReadUncommittedLevel, "y", "1"),
+		NewCommit("t1", ReadUncommittedLevel),
+		NewCommit("t2", ReadUncommittedLevel),
+	})
+
+	want := []Phenomenon{G0, G1c}
+	if !slices.Equal(phenomena(anomalies), want) {
+		t.Fatalf("got %v, want %v", anomalies, want)
+	}
+
+	wantCycle := "G0 (dirty write): t1 -ww(x)-> t2 -ww(y)-> t1"
+	if anomalies[0].String() != wantCycle {
+		t.Errorf("got %v, want %v", anomalies[0].String(), wantCycle)
+	}
+}
+
+func TestClassifyReadingBackOverwrittenWrite(t *testing.T) {
+	anomalies := classify(t, map[Key]Value{"x": "0"}, []Event{
+		NewWrite("t1", ReadUncommittedLevel, "x", "1"),
+		NewWrite("t2", ReadUncommittedLevel, "x", "2"),
+		NewRead("t1", ReadUncommittedLevel, "x"),
+		NewCommit("t1", ReadUncommittedLevel),
+		NewCommit("t2", ReadUncommittedLevel),
+	})
+
+	want := []Phenomenon{G1c}
+	if !slices.Equal(phenomena(anomalies), want) {
+		t.Fatalf("got %v, want %v", anomalies, want)
+	}
+
+	wantCycle := "G1c (circular information flow): t2 -wr(x)-> t1 -ww(x)-> t2"
+	if anomalies[0].String() != wantCycle {
+		t.Errorf("got %v, want %v", anomalies[0].String(), wantCycle)
+	}
+}
+
+func TestClassifyAbortedRead(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "0")
+	history := NewHistory()
+
+	t1 := NewRecordedTransaction("1", NewReadUncommitted("1", &table), history)
+	t2 := NewRecordedTransaction("2", NewReadUncommitted("2", &table), history)
+
+	t1.Set("x", "1")
+	t2.Get("x")
+	t1.Rollback()
+	t2.Commit()
+
+	anomalies := history.Classify()
+
+	want := []Phenomenon{G1a}
+	if !slices.Equal(phenomena(anomalies), want) {
+		t.Fatalf("got %v, want %v", anomalies, want)
+	}
+
+	wantRead := "G1a (aborted read): 2 read x = 1 written by 1"
+	if anomalies[0].String() != wantRead {
+		t.Errorf("got %v, want %v", anomalies[0].String(), wantRead)
+	}
+}
+
+func TestClassifyIntermediateRead(t *testing.T) {
+	anomalies := classify(t, map[Key]Value{"x": "0"}, []Event{
+		NewWrite("t1", ReadUncommittedLevel, "x", "1"),
+		NewRead("t2", ReadUncommittedLevel, "x"),
+		NewWrite("t1", ReadUncommittedLevel, "x", "2"),
+		NewCommit("t1", ReadUncommittedLevel),
+		NewCommit("t2", ReadUncommittedLevel),
+	})
+
+	want := []Phenomenon{G1b}
+	if !slices.Equal(phenomena(anomalies), want) {
+		t.Errorf("got %v, want %v", anomalies, want)
+	}
+}
+
+func TestClassifyCircularInformationFlow(t *testing.T) {
+	anomalies := classify(t, map[Key]Value{"x": "0", "y": "0"}, []Event{
+		NewWrite("t1", ReadUncommittedLevel, "x", "1"),
+		NewWrite("t2", ReadUncommittedLevel, "y", "2"),
+		NewRead("t1", ReadUncommittedLevel, "y"),
+		NewRead("t2", ReadUncommittedLevel, "x"),
+		NewCommit("t1", ReadUncommittedLevel),
+		NewCommit("t2", ReadUncommittedLevel),
+	})
+
+	want := []Phenomenon{G1c}
+	if !slices.Equal(phenomena(anomalies), want) {
+		t.Errorf("got %v, want %v", anomalies, want)
+	}
+}
+
+func TestClassifyReadSkew(t *testing.T) {
+	anomalies := classify(t, map[Key]Value{"x": "50", "y": "50"}, []Event{
+		NewRead("t1", ReadCommittedLevel, "x"),
+		NewWrite("t2", ReadCommittedLevel, "x", "40"),
+		NewWrite("t2", ReadCommittedLevel, "y", "60"),
+		NewCommit("t2", ReadCommittedLevel),
+		NewRead("t1", ReadCommittedLevel, "y"),
+		NewCommit("t1", ReadCommittedLevel),
+	})
+
+	want := []Phenomenon{GSingle, G2}
+	if !slices.Equal(phenomena(anomalies), want) {
+		t.Fatalf("got %v, want %v", anomalies, want)
+	}
+
+	wantCycle := "G-single (read skew): t1 -rw(x)-> t2 -wr(y)-> t1"
+	if anomalies[0].String() != wantCycle {
+		t.Errorf("got %v, want %v", anomalies[0].String(), wantCycle)
+	}
+}
+
+func TestClassifyWriteSkew(t *testing.T) {
+	for _, level := range []TransactionLevel{SnapshotIsolationLevel, SerializableSnapshotIsolationLevel} {
+		anomalies := classify(t, map[Key]Value{"x": "true", "y": "true"}, []Event{
+			NewRead("t1", level, "y"),
+			NewRead("t2", level, "x"),
+			NewWrite("t1", level, "x", "false"),
+			NewWrite("t2", level, "y", "false"),
+			NewCommit("t1", level),
+			NewCommit("t2", level),
+		})
+
+		want := []Phenomenon{G2}
+		if level == SerializableSnapshotIsolationLevel {
+			want = []Phenomenon{}
+		}
+
+		if !slices.Equal(phenomena(anomalies), want) {
+			t.Errorf("%v: got %v, want %v", level, anomalies, want)
+		}
+	}
+}
+
+func TestPlayEventsAnnotatesAnomalies(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "true")
+	table.Data["y"] = NewRow("y", "true")
+	table.History = NewHistory()
+
+	events := []Event{
+		NewRead("t1", SnapshotIsolationLevel, "y"),
+		NewRead("t2", SnapshotIsolationLevel, "x"),
+		NewWrite("t1", SnapshotIsolationLevel, "x", "false"),
+		NewWrite("t2", SnapshotIsolationLevel, "y", "false"),
+		NewCommit("t1", SnapshotIsolationLevel),
+		NewCommit("t2", SnapshotIsolationLevel),
+	}
+
+	producedMermaid, err := PlayEvents(events, &table)
+	if err != nil {
+		t.Fatalf("expected PlayEvents to succeed, got error: %v", err)
+	}
+
+	want := "note over t1,t2: G2 (write skew): t1 -rw(y)-> t2 -rw(x)-> t1\n"
+	if !strings.HasSuffix(producedMermaid, want) {
+		t.Errorf("got %v, want it to end with %v", producedMermaid, want)
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+type Verdict int
+
+const (
+	Prevented Verdict = iota
+	Allowed
+)
+
+func (v Verdict) String() string {
+	if v == Allowed {
+		return "allowed"
+	}
+
+	return "prevented"
+}
+
+// Scenario is a script exhibiting an anomaly unless the isolation level
+// prevents it. The levels of the events are replaced by the one the
+// scenario runs under.
+type Scenario struct {
+	Name       string
+	Phenomenon Phenomenon
+	Initial    map[Key]Value
+	Script     []Event
+	Expected   map[TransactionLevel]Verdict
+}
+
+// Run plays the script under level and tells whether the history it left
+// shows the phenomenon of the scenario.
+func (s Scenario) Run(level TransactionLevel) (Verdict, error) {
+	table := NewTable()
+	for key, value := range s.Initial {
+		table.Data[key] = NewRow(key, value)
+	}
+	table.History = NewHistory()
+
+	events := make([]Event, 0, len(s.Script))
+	for _, event := range s.Script {
+		events = append(events, withLevel(event, level))
+	}
+
+	if _, err := PlayEvents(events, &table); err != nil {
+		return Prevented, err
+	}
+
+	for _, anomaly := range table.History.Classify() {
+		if anomaly.Phenomenon == s.Phenomenon {
+			return Allowed, nil
+		}
+	}
+
+	return Prevented, nil
+}
+
+func Catalog() []Scenario {
+	const level = ReadUncommittedLevel
+
+	return []Scenario{
+		{
+			// t1 and t2 overwrite each other's uncommitted writes, of x and
+			// of y in opposite orders
+			Name:       "dirty write",
+			Phenomenon: G0,
+			Initial:    map[Key]Value{"x": "0", "y": "0"},
+			Script: []Event{
+				NewWrite("t1", level, "x", "1"),
+				NewWrite("t2", level, "x", "2"),
+				NewWrite("t2", level, "y", "2"),
+				NewWrite("t1", level, "y", "1"),
+				NewCommit("t1", level),
+				NewCommit("t2", level),
+			},
+			Expected: map[TransactionLevel]Verdict{
+				ReadUncommittedLevel:               Allowed,
+				ReadCommittedLevel:                 Prevented,
+				SnapshotIsolationLevel:             Prevented,
+				TwoPhaseLockingLevel:               Prevented,
+				SerializableSnapshotIsolationLevel: Prevented,
+				OptimisticConcurrencyControlLevel:  Prevented,
+				TimestampOrderingLevel:             Prevented,
+				MultiVersionTimestampOrderingLevel: Prevented,
+			},
+		},
+		{
+			// t1 reading back the value t2 overwrote its write with
+			Name:       "circular information flow",
+			Phenomenon: G1c,
+			Initial:    map[Key]Value{"x": "0"},
+			Script: []Event{
+				NewWrite("t1", level, "x", "1"),
+				NewWrite("t2", level, "x", "2"),
+				NewRead("t1", level, "x"),
+				NewCommit("t1", level),
+				NewCommit("t2", level),
+			},
+			Expected: map[TransactionLevel]Verdict{
+				ReadUncommittedLevel:               Allowed,
+				ReadCommittedLevel:                 Prevented,
+				SnapshotIsolationLevel:             Prevented,
+				TwoPhaseLockingLevel:               Prevented,
+				SerializableSnapshotIsolationLevel: Prevented,
+				OptimisticConcurrencyControlLevel:  Prevented,
+				TimestampOrderingLevel:             Prevented,
+				MultiVersionTimestampOrderingLevel: Prevented,
+			},
+		},
+		{
+			Name:       "dirty read",
+			Phenomenon: G1b,
+			Initial:    map[Key]Value{"x": "0"},
+			Script: []Event{
+				NewWrite("t1", level, "x", "1"),
+				NewRead("t2", level, "x"),
+				NewWrite("t1", level, "x", "2"),
+				NewCommit("t1", level),
+				NewCommit("t2", level),
+			},
+			Expected: map[TransactionLevel]Verdict{
+				ReadUncommittedLevel:               Allowed,
+				ReadCommittedLevel:                 Prevented,
+				SnapshotIsolationLevel:             Prevented,
+				TwoPhaseLockingLevel:               Prevented,
+				SerializableSnapshotIsolationLevel: Prevented,
+				OptimisticConcurrencyControlLevel:  Prevented,
+				TimestampOrderingLevel:             Prevented,
+				MultiVersionTimestampOrderingLevel: Prevented,
+			},
+		},
+		{
+			Name:       "lost update",
+			Phenomenon: GSingle,
+			Initial:    map[Key]Value{"counter": "0"},
+			Script: []Event{
+				NewRead("t1", level, "counter"),
+				NewRead("t2", level, "counter"),
+				NewWrite("t1", level, "counter", "1"),
+				NewWrite("t2", level, "counter", "1"),
+				NewCommit("t1", level),
+				NewCommit("t2", level),
+			},
+			Expected: map[TransactionLevel]Verdict{
+				ReadUncommittedLevel:   Allowed,
+				ReadCommittedLevel:     Allowed,
+				SnapshotIsolationLevel: Prevented,
+				// both transactions upgrading their read lock deadlock,
+				// t2 is the victim
+				TwoPhaseLockingLevel:               Prevented,
+				SerializableSnapshotIsolationLevel: Prevented,
+				OptimisticConcurrencyControlLevel:  Prevented,
+				TimestampOrderingLevel:             Prevented,
+				MultiVersionTimestampOrderingLevel: Prevented,
+			},
+		},
+		{
+			Name:       "read skew",
+			Phenomenon: GSingle,
+			Initial:    map[Key]Value{"x": "50", "y": "50"},
+			Script: []Event{
+				NewRead("t1", level, "x"),
+				NewWrite("t2", level, "x", "40"),
+				NewWrite("t2", level, "y", "60"),
+				NewCommit("t2", level),
+				NewRead("t1", level, "y"),
+				NewCommit("t1", level),
+			},
+			Expected: map[TransactionLevel]Verdict{
+				ReadUncommittedLevel:               Allowed,
+				ReadCommittedLevel:                 Allowed,
+				SnapshotIsolationLevel:             Prevented,
+				TwoPhaseLockingLevel:               Prevented,
+				SerializableSnapshotIsolationLevel: Prevented,
+				OptimisticConcurrencyControlLevel:  Prevented,
+				TimestampOrderingLevel:             Prevented,
+				MultiVersionTimestampOrderingLevel: Prevented,
+			},
+		},
+		{
+			Name:       "write skew",
+			Phenomenon: G2,
+			Initial:    map[Key]Value{"doctor-a-is-on-call": "true", "doctor-b-is-on-call": "true"},
+			Script: []Event{
+				NewRead("doctor-a", level, "doctor-b-is-on-call"),
+				NewRead("doctor-b", level, "doctor-a-is-on-call"),
+				NewWrite("doctor-a", level, "doctor-a-is-on-call", "false"),
+				NewWrite("doctor-b", level, "doctor-b-is-on-call", "false"),
+				NewCommit("doctor-a", level),
+				NewCommit("doctor-b", level),
+			},
+			Expected: map[TransactionLevel]Verdict{
+				ReadUncommittedLevel:               Allowed,
+				ReadCommittedLevel:                 Allowed,
+				SnapshotIsolationLevel:             Allowed,
+				TwoPhaseLockingLevel:               Prevented,
+				SerializableSnapshotIsolationLevel: Prevented,
+				OptimisticConcurrencyControlLevel:  Prevented,
+				TimestampOrderingLevel:             Prevented,
+				MultiVersionTimestampOrderingLevel: Prevented,
+			},
+		},
+		{
+			// t1 scanning the range again after t2 inserted into it
+			Name:       "phantom read",
+			Phenomenon: GSingle,
+			Initial:    map[Key]Value{"employee-1": "sales"},
+			Script: []Event{
+				NewScan("t1", level, "employee-0", "employee-9"),
+				NewWrite("t2", level, "employee-2", "sales"),
+				NewCommit("t2", level),
+				NewScan("t1", level, "employee-0", "employee-9"),
+				NewCommit("t1", level),
+			},
+			Expected: map[TransactionLevel]Verdict{
+				ReadUncommittedLevel:               Allowed,
+				ReadCommittedLevel:                 Allowed,
+				SnapshotIsolationLevel:             Prevented,
+				TwoPhaseLockingLevel:               Prevented,
+				SerializableSnapshotIsolationLevel: Prevented,
+				OptimisticConcurrencyControlLevel:  Prevented,
+				TimestampOrderingLevel:             Prevented,
+				MultiVersionTimestampOrderingLevel: Prevented,
+			},
+		},
+		{
+			// both transactions book the room after finding it free
+			Name:       "phantom write skew",
+			Phenomenon: G2,
+			Initial:    map[Key]Value{},
+			Script: []Event{
+				NewScan("t1", level, "room-a-09:00", "room-a-09:59"),
+				NewScan("t2", level, "room-a-09:00", "room-a-09:59"),
+				NewWrite("t1", level, "room-a-09:00", "t1"),
+				NewWrite("t2", level, "room-a-09:30", "t2"),
+				NewCommit("t1", level),
+				NewCommit("t2", level),
+			},
+			Expected: map[TransactionLevel]Verdict{
+				ReadUncommittedLevel:               Allowed,
+				ReadCommittedLevel:                 Allowed,
+				SnapshotIsolationLevel:             Allowed,
+				TwoPhaseLockingLevel:               Prevented,
+				SerializableSnapshotIsolationLevel: Prevented,
+				OptimisticConcurrencyControlLevel:  Prevented,
+				TimestampOrderingLevel:             Prevented,
+				MultiVersionTimestampOrderingLevel: Prevented,
+			},
+		},
+	}
+}
+
+// Matrix holds the verdict of every scenario under every level, like the
+// table of Berenson et al. in A Critique of ANSI SQL Isolation Levels.
+type Matrix struct {
+	Scenarios []string
+	Levels    []TransactionLevel
+	Verdicts  [][]Verdict
+}
+
+func RunCatalog(scenarios []Scenario, levels []TransactionLevel) (Matrix, error) {
+	matrix := Matrix{
+		Scenarios: make([]string, 0),
+		Levels:    levels,
+		Verdicts:  make([][]Verdict, 0),
+	}
+
+	for _, scenario := range scenarios {
+		verdicts := make([]Verdict, 0)
+
+		for _, level := range levels {
+			verdict, err := scenario.Run(level)
+			if err != nil {
+				return matrix, fmt.Errorf("%v under %v: %w", scenario.Name, level, err)
+			}
+
+			verdicts = append(verdicts, verdict)
+		}
+
+		matrix.Scenarios = append(matrix.Scenarios, scenario.Name)
+		matrix.Verdicts = append(matrix.Verdicts, verdicts)
+	}
+
+	return matrix, nil
+}
+
+// String renders the matrix as a markdown table.
+func (m Matrix) String() string {
+	var res strings.Builder
+
+	res.WriteString("| anomaly |")
+	for _, level := range m.Levels {
+		fmt.Fprintf(&res, " %v |", level)
+	}
+	res.WriteString("\n|---|" + strings.Repeat("---|", len(m.Levels)) + "\n")
+
+	for i, scenario := range m.Scenarios {
+		fmt.Fprintf(&res, "| %v |", scenario)
+		for _, verdict := range m.Verdicts[i] {
+			fmt.Fprintf(&res, " %v |", verdict)
+		}
+		res.WriteString("\n")
+	}
+
+	return res.String()
+}
+
+func (m Matrix) Verdict(scenario string, level TransactionLevel) (Verdict, bool) {
+	i := slices.Index(m.Scenarios, scenario)
+	j := slices.Index(m.Levels, level)
+
+	if i < 0 || j < 0 {
+		return Prevented, false
+	}
+
+	return m.Verdicts[i][j], true
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCatalogMatchesExpectedVerdicts(t *testing.T) {
+	catalog := Catalog()
+
+	matrix, err := RunCatalog(catalog, TransactionLevels())
+	if err != nil {
+		t.Fatalf("expected the catalog to run, got error: %v", err)
+	}
+
+	for _, scenario := range catalog {
+		for _, level := range TransactionLevels() {
+			got, _ := matrix.Verdict(scenario.Name, level)
+			if want := scenario.Expected[level]; got != want {
+				t.Errorf("%v under %v: got %v, want %v", scenario.Name, level, got, want)
+			}
+		}
+	}
+}
+
+func TestMatrixRendersMarkdownTable(t *testing.T) {
+	matrix, err := RunCatalog(Catalog()[:1], []TransactionLevel{ReadUncommittedLevel, ReadCommittedLevel})
+	if err != nil {
+		t.Fatalf("expected the catalog to run, got error: %v", err)
+	}
+
+	want := strings.Join([]string{
+		"| anomaly | read uncommitted | read committed |",
+		"|---|---|---|",
+		"| dirty write | allowed | prevented |",
+		"",
+	}, "\n")
+
+	if matrix.String() != want {
+		t.Errorf("got %v, want %v", matrix.String(), want)
+	}
+}
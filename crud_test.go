@@ -11,6 +11,7 @@ func TestCrud(t *testing.T) {
 		NewReadCommitted("1", &table),
 		NewSnapshotIsolation("1", &table),
 		NewTwoPhaseLocking("1", &table),
+		NewSerializableSnapshotIsolation("1", &table),
 	}
 
 	for _, tx := range transactions {
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWaitDieYoungerRequesterDies(t *testing.T) {
+	table := NewTable()
+	table.LockManager.SetDeadlockPolicy(WaitDie)
+	table.Data["x"] = NewRow("x", "A")
+	table.Data["y"] = NewRow("y", "A")
+
+	older := NewTwoPhaseLocking("older", &table)
+	younger := NewTwoPhaseLocking("younger", &table)
+
+	older.Lock("x")
+	younger.Lock("y")
+
+	err := younger.TrySet("x", "B")
+
+	var preventionErr *DeadlockPreventionError
+	if !errors.As(err, &preventionErr) || preventionErr.Older != "older" {
+		t.Fatalf("got %v, want younger to die", err)
+	}
+
+	if younger.GetStatus() != AbortedStatus {
+		t.Errorf("got %v, want %v", younger.GetStatus(), AbortedStatus)
+	}
+
+	if err := older.TrySet("y", "B"); err != nil {
+		t.Errorf("got %v, want older to get the lock the dead transaction released", err)
+	}
+
+	if table.LockManager.GetAborts() != 1 {
+		t.Errorf("got %v aborts, want 1", table.LockManager.GetAborts())
+	}
+}
+
+func TestWaitDieOlderRequesterWaits(t *testing.T) {
+	table := NewTable()
+	table.LockManager.SetDeadlockPolicy(WaitDie)
+	table.Data["x"] = NewRow("x", "A")
+
+	older := NewTwoPhaseLocking("older", &table)
+	younger := NewTwoPhaseLocking("younger", &table)
+
+	table.LockManager.RegisterTransaction("older")
+	younger.Lock("x")
+
+	olderDone := make(chan error)
+	go func() {
+		olderDone <- older.TrySet("x", "B")
+	}()
+
+	waitUntilWaiting(t, &table, "older")
+	younger.Commit()
+
+	if err := <-olderDone; err != nil {
+		t.Errorf("got %v, want older to wait for the lock", err)
+	}
+}
+
+func TestWoundWaitOlderRequesterWoundsIdleOwner(t *testing.T) {
+	table := NewTable()
+	table.LockManager.SetDeadlockPolicy(WoundWait)
+	table.Data["x"] = NewRow("x", "A")
+	table.Data["y"] = NewRow("y", "A")
+
+	older := NewTwoPhaseLocking("older", &table)
+	younger := NewTwoPhaseLocking("younger", &table)
+
+	table.LockManager.RegisterTransaction("older")
+	younger.Set("x", "C")
+
+	olderDone := make(chan error)
+	go func() {
+		olderDone <- older.TrySet("x", "B")
+	}()
+
+	waitUntilWaiting(t, &table, "older")
+
+	err := younger.TrySet("y", "C")
+
+	var preventionErr *DeadlockPreventionError
+	if !errors.As(err, &preventionErr) || preventionErr.Policy != WoundWait {
+		t.Fatalf("got %v, want younger to be wounded", err)
+	}
+
+	select {
+	case err := <-olderDone:
+		if err != nil {
+			t.Errorf("got %v, want older to proceed", err)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("older did not proceed after wounding younger")
+	}
+}
+
+func TestWoundWaitWoundsWaitingOwner(t *testing.T) {
+	table := NewTable()
+	table.LockManager.SetDeadlockPolicy(WoundWait)
+	table.Data["x"] = NewRow("x", "A")
+	table.Data["y"] = NewRow("y", "A")
+
+	older := NewTwoPhaseLocking("older", &table)
+	younger := NewTwoPhaseLocking("younger", &table)
+
+	older.Lock("y")
+	younger.Lock("x")
+
+	youngerDone := make(chan error)
+	go func() {
+		youngerDone <- younger.TrySet("y", "C")
+	}()
+
+	waitUntilWaiting(t, &table, "younger")
+
+	if err := older.TrySet("x", "B"); err != nil {
+		t.Errorf("got %v, want older to get the lock of the wounded transaction", err)
+	}
+
+	var preventionErr *DeadlockPreventionError
+	if err := <-youngerDone; !errors.As(err, &preventionErr) {
+		t.Errorf("got %v, want younger to be wounded while waiting", err)
+	}
+}
+
+func TestTransactionAgeComesFromPlayEventsOrder(t *testing.T) {
+	table := NewTable()
+	table.LockManager.SetDeadlockPolicy(WaitDie)
+	table.Data["x"] = NewRow("x", "A")
+
+	events := []Event{
+		NewRead("b", TwoPhaseLockingLevel, "x"),
+		NewCommit("b", TwoPhaseLockingLevel),
+		NewRead("a", TwoPhaseLockingLevel, "x"),
+		NewCommit("a", TwoPhaseLockingLevel),
+	}
+
+	if _, err := PlayEvents(events, &table); err != nil {
+		t.Fatalf("expected PlayEvents to succeed, got error: %v", err)
+	}
+
+	b := NewTwoPhaseLocking("b", &table)
+	a := NewTwoPhaseLocking("a", &table)
+
+	b.Lock("x")
+
+	var preventionErr *DeadlockPreventionError
+	if err := a.TryLock("x"); !errors.As(err, &preventionErr) || preventionErr.Older != "b" {
+		t.Errorf("got %v, want a to die as it appeared after b", err)
+	}
+}
+
+func TestPlayEventsWoundedOwnerCannotCommit(t *testing.T) {
+	tests := []struct {
+		policy     DeadlockPolicy
+		wantErr    string
+		wantAborts int
+	}{
+		{policy: DeadlockDetection, wantErr: "", wantAborts: 0},
+		{policy: WaitDie, wantErr: "", wantAborts: 0},
+		{policy: WoundWait, wantErr: "t2 was wounded by older transaction t1", wantAborts: 1},
+	}
+
+	for _, tt := range tests {
+		table := NewTable()
+		table.Data["x"] = NewRow("x", "0")
+		table.Data["y"] = NewRow("y", "0")
+		table.LockManager.SetDeadlockPolicy(tt.policy)
+
+		events := []Event{
+			NewRead("t1", TwoPhaseLockingLevel, "y"),
+			NewWrite("t2", TwoPhaseLockingLevel, "x", "2"),
+			NewWrite("t1", TwoPhaseLockingLevel, "x", "1"),
+			NewCommit("t2", TwoPhaseLockingLevel),
+			NewCommit("t1", TwoPhaseLockingLevel),
+		}
+
+		if _, err := PlayEvents(events, &table); err != nil {
+			t.Fatalf("%v: expected PlayEvents to succeed, got error: %v", tt.policy, err)
+		}
+
+		gotErr := ""
+		if events[3].Err != nil {
+			gotErr = events[3].Err.Error()
+		}
+
+		if gotErr != tt.wantErr {
+			t.Errorf("%v: got %v, want %v", tt.policy, gotErr, tt.wantErr)
+		}
+
+		if got := table.LockManager.GetAborts(); got != tt.wantAborts {
+			t.Errorf("%v: got %v aborts, want %v", tt.policy, got, tt.wantAborts)
+		}
+
+		if got := table.Data["x"].Committed; got != "1" {
+			t.Errorf("%v: got %v, want %v", tt.policy, got, "1")
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeadlockVictimIsAborted(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "A")
+	table.Data["y"] = NewRow("y", "A")
+
+	t1 := NewTwoPhaseLocking("1", &table)
+	t2 := NewTwoPhaseLocking("2", &table)
+
+	t1.Lock("x")
+	t2.Lock("y")
+
+	t1Done := make(chan error)
+	go func() {
+		t1Done <- t1.TrySet("y", "B")
+	}()
+
+	waitUntilWaiting(t, &table, "1")
+
+	err := t2.TrySet("x", "C")
+
+	var deadlockErr *DeadlockError
+	if !errors.As(err, &deadlockErr) {
+		t.Fatalf("got %v, want deadlock error", err)
+	}
+
+	wantCycle := []TransactionId{"2", "1", "2"}
+	if !slices.Equal(deadlockErr.Cycle, wantCycle) {
+		t.Errorf("got %v, want %v", deadlockErr.Cycle, wantCycle)
+	}
+
+	if t2.GetStatus() != AbortedStatus {
+		t.Errorf("got %v, want %v", t2.GetStatus(), AbortedStatus)
+	}
+
+	select {
+	case err := <-t1Done:
+		if err != nil {
+			t.Errorf("got %v, want t1 to proceed", err)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("t1 did not proceed after the victim was aborted")
+	}
+
+	var finishedErr *TransactionFinishedError
+	if err := t2.TryCommit(); !errors.As(err, &finishedErr) {
+		t.Errorf("got %v, want transaction finished error", err)
+	}
+
+	if err := t2.TryRollback(); err != nil {
+		t.Errorf("got %v, want rollback to succeed", err)
+	}
+
+	t1.Commit()
+
+	if value := t2.Get("y"); value != "B" {
+		t.Errorf("got %v, want %v", value, "B")
+	}
+}
+
+func TestWaitsForGraph(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "A")
+
+	t1 := NewTwoPhaseLocking("1", &table)
+	t2 := NewTwoPhaseLocking("2", &table)
+	t3 := NewTwoPhaseLocking("3", &table)
+
+	t1.Get("x")
+	t2.Get("x")
+
+	go t3.Set("x", "B")
+	waitUntilWaiting(t, &table, "3")
+
+	waitsFor := table.LockManager.GetWaitsFor()
+	if !slices.Equal(waitsFor["3"], []TransactionId{"1", "2"}) {
+		t.Errorf("got %v, want 3 to wait for 1 and 2", waitsFor)
+	}
+
+	t1.Commit()
+	t2.Commit()
+
+	if table.LockManager.IsWaiting("3") {
+		t.Error("3 should hold the lock after 1 and 2 committed")
+	}
+}
+
+func waitUntilWaiting(t *testing.T, table *Table, txId TransactionId) {
+	deadline := time.Now().Add(100 * time.Millisecond)
+
+	for !table.LockManager.IsWaiting(txId) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%v did not start waiting", txId)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPlayEventsThreeWayDeadlock(t *testing.T) {
+	table := NewTable()
+	for _, key := range []Key{"x", "y", "z"} {
+		table.Data[key] = NewRow(key, "0")
+	}
+
+	events := []Event{
+		NewWrite("t1", TwoPhaseLockingLevel, "x", "1"),
+		NewWrite("t2", TwoPhaseLockingLevel, "y", "2"),
+		NewWrite("t3", TwoPhaseLockingLevel, "z", "3"),
+		NewWrite("t1", TwoPhaseLockingLevel, "y", "1"),
+		NewWrite("t2", TwoPhaseLockingLevel, "z", "2"),
+		NewWrite("t3", TwoPhaseLockingLevel, "x", "3"),
+		NewRollback("t3", TwoPhaseLockingLevel),
+		NewCommit("t2", TwoPhaseLockingLevel),
+		NewCommit("t1", TwoPhaseLockingLevel),
+	}
+
+	mermaid, err := PlayEvents(events, &table)
+	if err != nil {
+		t.Fatalf("expected PlayEvents to succeed, got error: %v", err)
+	}
+
+	want := "note over t1,t3: deadlock detected, t3 waits for t1 waits for t2 waits for t3"
+	if !strings.Contains(mermaid, want) {
+		t.Errorf("expected %q in\n%v", want, mermaid)
+	}
+
+	if strings.Contains(mermaid, "note over t1,t2,t3") {
+		t.Errorf("expected notes over at most two participants in\n%v", mermaid)
+	}
+
+	for key, value := range map[Key]Value{"x": "1", "y": "1", "z": "2"} {
+		if got := table.Data[key].Committed; got != value {
+			t.Errorf("%v: got %v, want %v", key, got, value)
+		}
+	}
+}
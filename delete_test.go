@@ -0,0 +1,117 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDelete(t *testing.T) {
+	table := NewTable()
+	transactions := []Transaction{
+		NewReadUncommitted("1", &table),
+		NewReadCommitted("1", &table),
+		NewSnapshotIsolation("1", &table),
+		NewTwoPhaseLocking("1", &table),
+		NewSerializableSnapshotIsolation("1", &table),
+	}
+
+	for _, tx := range transactions {
+		table = NewTable()
+		table.Data["x"] = NewRow("x", "A")
+
+		if value := tx.Delete("x").Get("x"); value != EmptyValue() {
+			t.Errorf("got %v, want %v", value, EmptyValue())
+		}
+
+		if value := tx.Rollback().Get("x"); value != "A" {
+			t.Errorf("got %v, want %v", value, "A")
+		}
+
+		if value := tx.Delete("x").Commit().Get("x"); value != EmptyValue() {
+			t.Errorf("got %v, want %v", value, EmptyValue())
+		}
+
+		if value := tx.Set("x", "B").Commit().Get("x"); value != "B" {
+			t.Errorf("got %v, want %v", value, "B")
+		}
+
+		tx.Commit()
+	}
+}
+
+func TestUncommittedDeleteVisibility(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "A")
+
+	NewReadUncommitted("1", &table).Delete("x")
+
+	if value := NewReadUncommitted("2", &table).Get("x"); value != EmptyValue() {
+		t.Errorf("read uncommitted: got %v, want %v", value, EmptyValue())
+	}
+
+	if value := NewReadCommitted("3", &table).Get("x"); value != "A" {
+		t.Errorf("read committed: got %v, want %v", value, "A")
+	}
+}
+
+func TestUncommittedInsertIsNotCommitted(t *testing.T) {
+	table := NewTable()
+
+	t1 := NewReadCommitted("1", &table)
+	t2 := NewReadCommitted("2", &table)
+
+	t1.Set("x", "A")
+
+	if value := t2.Get("x"); value != EmptyValue() {
+		t.Errorf("got %v, want %v", value, EmptyValue())
+	}
+
+	t1.Rollback()
+
+	if value := t2.Get("x"); value != EmptyValue() {
+		t.Errorf("got %v, want %v", value, EmptyValue())
+	}
+}
+
+func TestSnapshotKeepsDeletedRow(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "A")
+
+	t1 := NewSnapshotIsolation("1", &table)
+	t2 := NewSnapshotIsolation("2", &table)
+
+	t2.Delete("x").Commit()
+
+	if value := t1.Get("x"); value != "A" {
+		t.Errorf("got %v, want %v", value, "A")
+	}
+
+	t1.Commit()
+
+	if value := t1.Get("x"); value != EmptyValue() {
+		t.Errorf("got %v, want %v", value, EmptyValue())
+	}
+}
+
+func TestPlayEventsRendersDelete(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "A")
+
+	events := []Event{
+		NewDelete("t1", ReadCommittedLevel, "x"),
+		NewCommit("t1", ReadCommittedLevel),
+	}
+
+	producedMermaid, err := PlayEvents(events, &table)
+	if err != nil {
+		t.Fatalf("expected PlayEvents to succeed, got error: %v", err)
+	}
+
+	if !strings.Contains(producedMermaid, "t1 ->> x: delete x") {
+		t.Errorf("got %v, want a delete arrow", producedMermaid)
+	}
+
+	if committed := table.Data["x"].Committed; committed != TombstoneValue() {
+		t.Errorf("got %v, want %v", committed, TombstoneValue())
+	}
+}
@@ -17,6 +17,10 @@ func TestDirtyReadsWrites(t *testing.T) {
 			NewSnapshotIsolation("1", &table),
 			NewSnapshotIsolation("2", &table),
 		},
+		{
+			NewSerializableSnapshotIsolation("1", &table),
+			NewSerializableSnapshotIsolation("2", &table),
+		},
 		// TODO
 		// {
 		// 	NewTwoPhaseLocking("1", &table),
@@ -50,6 +54,7 @@ func testDirtyReads(t *testing.T, txPair []Transaction) {
 	}
 
 	t2.Commit()
+	t1.Commit()
 	afterCommitted := t1.Get("x")
 	if afterCommitted != "B" {
 		t.Errorf("got %v, want %v", afterCommitted, "B")
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrSerializationFailure = errors.New("could not serialize access due to read/write dependencies among transactions")
+var ErrConcurrentUpdate = errors.New("could not serialize access due to concurrent update")
+var ErrValidationFailure = errors.New("could not serialize access, values read changed since the transaction started")
+var ErrLockAfterShrinking = errors.New("cannot acquire a new lock once the transaction started releasing its locks")
+
+type SerializationFailureError struct {
+	TxId  TransactionId
+	Cause error
+}
+
+func (e *SerializationFailureError) Error() string {
+	return e.Cause.Error()
+}
+
+func (e *SerializationFailureError) Unwrap() error {
+	return e.Cause
+}
+
+// DeadlockError is returned to the victim of a deadlock, Cycle starts and ends
+// with the victim.
+type DeadlockError struct {
+	TxId  TransactionId
+	Cycle []TransactionId
+}
+
+func (e *DeadlockError) Error() string {
+	cycle := make([]string, 0)
+	for _, txId := range e.Cycle {
+		cycle = append(cycle, string(txId))
+	}
+
+	return "deadlock detected, " + strings.Join(cycle, " waits for ")
+}
+
+// DeadlockPreventionError is returned to the transaction a deadlock
+// prevention policy aborted because Older holds or wants its lock.
+type DeadlockPreventionError struct {
+	TxId   TransactionId
+	Policy DeadlockPolicy
+	Older  TransactionId
+}
+
+func (e *DeadlockPreventionError) Error() string {
+	if e.Policy == WoundWait {
+		return fmt.Sprintf("%v was wounded by older transaction %v", e.TxId, e.Older)
+	}
+
+	return fmt.Sprintf("%v dies waiting for older transaction %v", e.TxId, e.Older)
+}
+
+// CascadingAbortError aborts a transaction that read or overwrote Key while
+// Writer had not committed it yet, once Writer rolled back.
+type CascadingAbortError struct {
+	TxId   TransactionId
+	Writer TransactionId
+	Key    Key
+}
+
+func (e *CascadingAbortError) Error() string {
+	return fmt.Sprintf("%v aborted in cascade, %v rolled back its uncommitted write of %v", e.TxId, e.Writer, e.Key)
+}
+
+// UncommittedDependencyError is returned to a transaction trying to commit
+// before Writer, whose uncommitted write of Key it read or overwrote.
+type UncommittedDependencyError struct {
+	TxId   TransactionId
+	Writer TransactionId
+	Key    Key
+}
+
+func (e *UncommittedDependencyError) Error() string {
+	return fmt.Sprintf("%v cannot commit before %v, whose uncommitted write of %v it depends on", e.TxId, e.Writer, e.Key)
+}
+
+// LockNotAvailableError is returned to a transaction locking a row with NOWAIT
+// while another transaction holds a conflicting lock.
+type LockNotAvailableError struct {
+	TxId TransactionId
+	Key  Key
+}
+
+func (e *LockNotAvailableError) Error() string {
+	return fmt.Sprintf("could not obtain lock on row %v", e.Key)
+}
+
+type LockTimeoutError struct {
+	TxId TransactionId
+	Key  Key
+}
+
+func (e *LockTimeoutError) Error() string {
+	return fmt.Sprintf("canceling statement due to lock timeout on %v", e.Key)
+}
+
+// TooLateError is returned to a timestamp ordering transaction whose read or
+// write arrived after a younger transaction, with timestamp ConflictTs, read,
+// wrote or scanned the row.
+type TooLateError struct {
+	TxId          TransactionId
+	Timestamp     int
+	OperationType OperationType
+	Key           Key
+	ConflictType  OperationType
+	ConflictTs    int
+}
+
+func (e *TooLateError) Error() string {
+	operation, conflict := "write", "written"
+
+	switch {
+	case e.ConflictType == ScanOperation:
+		operation, conflict = "insert", "scanned"
+	case e.OperationType == ReadOperation:
+		operation = "read"
+	case e.ConflictType == ReadOperation:
+		conflict = "read"
+	}
+
+	return fmt.Sprintf("%v with timestamp %d is too late to %v %v, %v at timestamp %d", e.TxId, e.Timestamp, operation, e.Key, conflict, e.ConflictTs)
+}
+
+type TransactionFinishedError struct {
+	TxId   TransactionId
+	Status TransactionStatus
+}
+
+func (e *TransactionFinishedError) Error() string {
+	if e.Status == AbortedStatus {
+		return fmt.Sprintf("transaction %v is aborted, commands ignored until rollback", e.TxId)
+	}
+
+	return fmt.Sprintf("transaction %v is already %v", e.TxId, e.Status)
+}
+
+// NotConflictSerializableError holds a cycle of the serialization graph of a
+// history, every conflict leads to the transaction of the next one.
+type NotConflictSerializableError struct {
+	Cycle []Conflict
+}
+
+func (e *NotConflictSerializableError) Error() string {
+	var cycle strings.Builder
+	cycle.WriteString(string(e.Cycle[0].From))
+
+	for _, conflict := range e.Cycle {
+		fmt.Fprintf(&cycle, " -%v(%v)-> %v", conflict.Type, conflict.Key, conflict.To)
+	}
+
+	return "history is not conflict serializable, " + cycle.String()
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLockForShareLetsOtherSharersIn(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "A")
+
+	NewReadCommitted("t1", &table).LockWith("x", LockMode{Strength: ForShare, WaitPolicy: Wait})
+
+	sharer := NewReadCommitted("t2", &table)
+	if isLocked, err := sharer.TryLockWith("x", LockMode{Strength: ForShare, WaitPolicy: NoWait}); !isLocked || err != nil {
+		t.Errorf("got %v, %v, want the row locked", isLocked, err)
+	}
+
+	updater := NewReadCommitted("t3", &table)
+	want := "could not obtain lock on row x"
+	var notAvailableErr *LockNotAvailableError
+	if _, err := updater.TryLockWith("x", LockMode{Strength: ForUpdate, WaitPolicy: NoWait}); !errors.As(err, &notAvailableErr) || err.Error() != want {
+		t.Errorf("got %v, want %v", err, want)
+	}
+
+	if status := updater.GetStatus(); status != AbortedStatus {
+		t.Errorf("got %v, want %v", status, AbortedStatus)
+	}
+}
+
+func TestLockSkipLockedSkipsLockedRow(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "A")
+
+	NewReadCommitted("t1", &table).Lock("x")
+
+	tx := NewReadCommitted("t2", &table)
+	if isLocked, err := tx.TryLockWith("x", LockMode{Strength: ForShare, WaitPolicy: SkipLocked}); isLocked || err != nil {
+		t.Errorf("got %v, %v, want the row skipped", isLocked, err)
+	}
+
+	if status := tx.GetStatus(); status != ActiveStatus {
+		t.Errorf("got %v, want %v", status, ActiveStatus)
+	}
+}
+
+func TestExplicitLockModesAtEveryLevel(t *testing.T) {
+	modes := []LockMode{
+		{Strength: ForUpdate, WaitPolicy: Wait},
+		{Strength: ForShare, WaitPolicy: Wait},
+		{Strength: ForUpdate, WaitPolicy: NoWait},
+		{Strength: ForShare, WaitPolicy: SkipLocked},
+	}
+
+	for _, level := range TransactionLevels() {
+		table := NewTable()
+		table.Data["x"] = NewRow("x", "A")
+
+		tx, err := TransactionFromTransactionLevel(level, "t1", &table)
+		if err != nil {
+			t.Fatalf("expected %v to start, got error: %v", level, err)
+		}
+
+		for _, mode := range modes {
+			if isLocked, err := tx.TryLockWith("x", mode); !isLocked || err != nil {
+				t.Errorf("%v, %v: got %v, %v, want the row locked", level, mode, isLocked, err)
+			}
+
+			if isLocked, err := tx.TryLockWith("y", mode); isLocked || err != nil {
+				t.Errorf("%v, %v: got %v, %v, want no row to lock", level, mode, isLocked, err)
+			}
+		}
+
+		if err := tx.TryCommit(); err != nil {
+			t.Errorf("%v: expected to commit, got error: %v", level, err)
+		}
+	}
+}
+
+func TestPlayEventsQueueWorkersSkipLockedJobs(t *testing.T) {
+	table := NewTable()
+	table.Data["job-1"] = NewRow("job-1", "pending")
+	table.Data["job-2"] = NewRow("job-2", "pending")
+
+	claim := LockMode{Strength: ForUpdate, WaitPolicy: SkipLocked}
+
+	events := []Event{
+		NewLock("w1", ReadCommittedLevel, "job-1", claim),
+		NewLock("w2", ReadCommittedLevel, "job-1", claim),
+		NewLock("w2", ReadCommittedLevel, "job-2", claim),
+		NewWrite("w1", ReadCommittedLevel, "job-1", "done by w1"),
+		NewWrite("w2", ReadCommittedLevel, "job-2", "done by w2"),
+		NewCommit("w1", ReadCommittedLevel),
+		NewCommit("w2", ReadCommittedLevel),
+	}
+
+	mermaid, err := PlayEvents(events, &table)
+	if err != nil {
+		t.Fatalf("expected PlayEvents to succeed, got error: %v", err)
+	}
+
+	want := "job-1 ->> w2: skipped"
+	if !strings.Contains(mermaid, want) {
+		t.Errorf("expected %q in\n%v", want, mermaid)
+	}
+
+	for key, value := range map[Key]Value{"job-1": "done by w1", "job-2": "done by w2"} {
+		if got := table.Data[key].Committed; got != value {
+			t.Errorf("%v: got %v, want %v", key, got, value)
+		}
+	}
+}
+
+func TestPlayEventsReservationsShareTheRoom(t *testing.T) {
+	table := NewTable()
+	table.Data["room-a"] = NewRow("room-a", "open")
+
+	forShare := LockMode{Strength: ForShare, WaitPolicy: Wait}
+
+	events := []Event{
+		NewLock("b1", ReadCommittedLevel, "room-a", forShare),
+		NewWrite("b1", ReadCommittedLevel, "booking-1", "room-a"),
+		NewLock("b2", ReadCommittedLevel, "room-a", forShare),
+		NewWrite("b2", ReadCommittedLevel, "booking-2", "room-a"),
+		NewDelete("admin", ReadCommittedLevel, "room-a"),
+		NewCommit("b1", ReadCommittedLevel),
+		NewCommit("b2", ReadCommittedLevel),
+		NewCommit("admin", ReadCommittedLevel),
+	}
+
+	mermaid, err := PlayEvents(events, &table)
+	if err != nil {
+		t.Fatalf("expected PlayEvents to succeed, got error: %v", err)
+	}
+
+	want := "note over room-a: granted b1 (read), b2 (read), waiting admin (write)"
+	if !strings.Contains(mermaid, want) {
+		t.Errorf("expected %q in\n%v", want, mermaid)
+	}
+
+	for _, event := range events {
+		if event.Err != nil {
+			t.Errorf("expected %v to succeed, got error: %v", describeOperation(event), event.Err)
+		}
+	}
+}
+
+func TestPlayEventsReservationNoWait(t *testing.T) {
+	table := NewTable()
+	table.Data["seat-1"] = NewRow("seat-1", "free")
+
+	reserve := LockMode{Strength: ForUpdate, WaitPolicy: NoWait}
+
+	events := []Event{
+		NewLock("t1", ReadCommittedLevel, "seat-1", reserve),
+		NewLock("t2", ReadCommittedLevel, "seat-1", reserve),
+		NewWrite("t1", ReadCommittedLevel, "seat-1", "t1"),
+		NewCommit("t1", ReadCommittedLevel),
+		NewRollback("t2", ReadCommittedLevel),
+	}
+
+	mermaid, err := PlayEvents(events, &table)
+	if err != nil {
+		t.Fatalf("expected PlayEvents to succeed, got error: %v", err)
+	}
+
+	want := "seat-1 -x t2: could not obtain lock on row seat-1"
+	if !strings.Contains(mermaid, want) {
+		t.Errorf("expected %q in\n%v", want, mermaid)
+	}
+
+	if got := table.Data["seat-1"].Committed; got != "t1" {
+		t.Errorf("got %v, want %v", got, "t1")
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Outcome is one distinct result of running an interleaving: what got
+// committed, what every transaction read and which transactions failed.
+type Outcome struct {
+	Committed map[Key]Value
+	Reads     map[TransactionId][]Value
+	Aborted   []TransactionId
+	Err       error
+	// Example is the first interleaving producing the outcome, as the
+	// transaction of every event in order.
+	Example []TransactionId
+	Count   int
+}
+
+func (o Outcome) String() string {
+	return fmt.Sprintf("committed %v, reads %v, aborted %v, err %v", o.Committed, o.Reads, o.Aborted, o.Err)
+}
+
+type Exploration struct {
+	Interleavings int
+	Outcomes      []*Outcome
+}
+
+// ExploreInterleavings plays every interleaving of the transactions that
+// keeps their own events in order, each against a fresh table holding
+// initial, with all transactions running under level.
+func ExploreInterleavings(initial map[Key]Value, transactions [][]Event, level TransactionLevel) Exploration {
+	exploration := Exploration{
+		Interleavings: 0,
+		Outcomes:      make([]*Outcome, 0),
+	}
+	outcomes := make(map[string]*Outcome)
+
+	forEachInterleaving(transactions, func(order []int) {
+		exploration.Interleavings++
+
+		table := NewTable()
+		for key, value := range initial {
+			table.Data[key] = NewRow(key, value)
+		}
+
+		events := make([]Event, 0, len(order))
+		next := make([]int, len(transactions))
+		for _, i := range order {
+			events = append(events, withLevel(transactions[i][next[i]], level))
+			next[i]++
+		}
+
+		_, err := PlayEvents(events, &table)
+		outcome := newOutcome(&table, events, err)
+
+		key := outcome.String()
+		if seen, ok := outcomes[key]; ok {
+			seen.Count++
+			return
+		}
+
+		outcomes[key] = outcome
+		exploration.Outcomes = append(exploration.Outcomes, outcome)
+	})
+
+	return exploration
+}
+
+// forEachInterleaving calls visit with the index of the transaction of every
+// event, for each order of events keeping the transactions' own order.
+func forEachInterleaving(transactions [][]Event, visit func(order []int)) {
+	total := 0
+	for _, events := range transactions {
+		total += len(events)
+	}
+
+	remaining := make([]int, len(transactions))
+	for i, events := range transactions {
+		remaining[i] = len(events)
+	}
+
+	order := make([]int, 0, total)
+
+	var walk func()
+	walk = func() {
+		if len(order) == total {
+			visit(order)
+			return
+		}
+
+		for i := range transactions {
+			if remaining[i] == 0 {
+				continue
+			}
+
+			remaining[i]--
+			order = append(order, i)
+			walk()
+			order = order[:len(order)-1]
+			remaining[i]++
+		}
+	}
+
+	walk()
+}
+
+func withLevel(event Event, level TransactionLevel) Event {
+	tableEvent := *event.TableEvent
+	tableEvent.TxLevel = level
+	tableEvent.Observed = ""
+	tableEvent.Err = nil
+
+	return Event{TableEvent: &tableEvent}
+}
+
+func newOutcome(table *Table, events []Event, err error) *Outcome {
+	outcome := &Outcome{
+		Committed: make(map[Key]Value),
+		Reads:     make(map[TransactionId][]Value),
+		Aborted:   make([]TransactionId, 0),
+		Err:       err,
+		Example:   make([]TransactionId, 0, len(events)),
+		Count:     1,
+	}
+
+	for key, row := range table.Data {
+		outcome.Committed[key] = row.Committed
+	}
+
+	for _, event := range events {
+		outcome.Example = append(outcome.Example, event.TxId)
+
+		if event.OperationType == ReadOperation || event.OperationType == ScanOperation {
+			outcome.Reads[event.TxId] = append(outcome.Reads[event.TxId], event.Observed)
+		}
+
+		// a refused operation may leave its transaction active, like a commit
+		// deferred until the writer it depends on commits
+		isAborted := event.Err != nil && event.Status != ActiveStatus
+		if isAborted && !slices.Contains(outcome.Aborted, event.TxId) {
+			outcome.Aborted = append(outcome.Aborted, event.TxId)
+		}
+	}
+
+	slices.Sort(outcome.Aborted)
+
+	return outcome
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func goingOffCall(doctor TransactionId, self Key, other Key) []Event {
+	return []Event{
+		NewRead(doctor, ReadCommittedLevel, other),
+		NewRead(doctor, ReadCommittedLevel, self),
+		NewWrite(doctor, ReadCommittedLevel, self, "false"),
+		NewCommit(doctor, ReadCommittedLevel),
+	}
+}
+
+func exploreWriteSkew(level TransactionLevel) Exploration {
+	initial := map[Key]Value{
+		"doctor-a-is-on-call": "true",
+		"doctor-b-is-on-call": "true",
+	}
+
+	return ExploreInterleavings(initial, [][]Event{
+		goingOffCall("doctor-a", "doctor-a-is-on-call", "doctor-b-is-on-call"),
+		goingOffCall("doctor-b", "doctor-b-is-on-call", "doctor-a-is-on-call"),
+	}, level)
+}
+
+// isWriteSkew tells whether both doctors went off call, each having seen the
+// other one on call.
+func isWriteSkew(outcome *Outcome) bool {
+	return outcome.Reads["doctor-a"][0] == "true" &&
+		outcome.Reads["doctor-b"][0] == "true" &&
+		outcome.Committed["doctor-a-is-on-call"] == "false" &&
+		outcome.Committed["doctor-b-is-on-call"] == "false"
+}
+
+func TestExplorerVisitsEveryInterleaving(t *testing.T) {
+	exploration := exploreWriteSkew(TwoPhaseLockingLevel)
+
+	if exploration.Interleavings != 70 {
+		t.Errorf("got %v, want %v", exploration.Interleavings, 70)
+	}
+
+	total := 0
+	for _, outcome := range exploration.Outcomes {
+		total += outcome.Count
+	}
+
+	if total != exploration.Interleavings {
+		t.Errorf("got %v, want %v", total, exploration.Interleavings)
+	}
+}
+
+func TestNoInterleavingProducesWriteSkewUnderTwoPhaseLocking(t *testing.T) {
+	for _, level := range []TransactionLevel{TwoPhaseLockingLevel, SerializableSnapshotIsolationLevel} {
+		for _, outcome := range exploreWriteSkew(level).Outcomes {
+			if outcome.Err != nil {
+				t.Errorf("%v: got %v, want every interleaving to finish", level, outcome.Err)
+			}
+
+			if isWriteSkew(outcome) {
+				t.Errorf("%v: got write skew for interleaving %v", level, outcome.Example)
+			}
+		}
+	}
+}
+
+func TestSomeInterleavingProducesWriteSkewUnderSnapshotIsolation(t *testing.T) {
+	for _, outcome := range exploreWriteSkew(SnapshotIsolationLevel).Outcomes {
+		if isWriteSkew(outcome) {
+			return
+		}
+	}
+
+	t.Error("expected an interleaving producing write skew")
+}
+
+func TestOutcomeCountsOnlyAbortingErrors(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "0")
+
+	deferred := NewCommit("t1", TwoPhaseLockingLevel)
+	deferred.Err = &UncommittedDependencyError{TxId: "t1", Writer: "t2", Key: "x"}
+	deferred.Status = ActiveStatus
+
+	refused := NewCommit("t2", SnapshotIsolationLevel)
+	refused.Err = ErrConcurrentUpdate
+	refused.Status = RolledBackStatus
+
+	outcome := newOutcome(&table, []Event{deferred, refused}, nil)
+
+	want := []TransactionId{"t2"}
+	if !slices.Equal(outcome.Aborted, want) {
+		t.Errorf("got %v, want %v", outcome.Aborted, want)
+	}
+}
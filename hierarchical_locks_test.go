@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLockCompatibilityMatrix(t *testing.T) {
+	lockLevels := []LockLevel{IntentionShared, IntentionExclusive, Read, SharedIntentionExclusive, ReadWrite}
+	compatible := [][]bool{
+		{true, true, true, true, false},
+		{true, true, false, false, false},
+		{true, false, true, false, false},
+		{true, false, false, false, false},
+		{false, false, false, false, false},
+	}
+
+	for i, lockLevel := range lockLevels {
+		for j, otherLockLevel := range lockLevels {
+			if got := !isConflicting(lockLevel, otherLockLevel); got != compatible[i][j] {
+				t.Errorf("%v with %v: got compatible %v, want %v", lockLevel, otherLockLevel, got, compatible[i][j])
+			}
+		}
+	}
+}
+
+func TestRowLocksTakeIntentionLocks(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "0")
+	table.Data["y"] = NewRow("y", "0")
+
+	tx := NewTwoPhaseLocking("t1", &table)
+	tx.Get("x")
+
+	want := "granted t1 (intention shared), waiting none"
+	if got := table.TableLockQueue().String(); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	tx.Set("y", "1")
+
+	want = "granted t1 (intention exclusive), waiting none"
+	if got := table.TableLockQueue().String(); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	tx.Commit()
+
+	want = "granted none, waiting none"
+	if got := table.TableLockQueue().String(); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestPlayEventsLockTableBlocksRowUpdates(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "0")
+
+	events := []Event{
+		NewLockTable("t1", ReadCommittedLevel, Read),
+		NewWrite("t2", ReadCommittedLevel, "x", "2"),
+		NewRead("t1", ReadCommittedLevel, "x"),
+		NewCommit("t1", ReadCommittedLevel),
+		NewCommit("t2", ReadCommittedLevel),
+	}
+
+	mermaid, err := PlayEvents(events, &table)
+	if err != nil {
+		t.Fatalf("expected PlayEvents to succeed, got error: %v", err)
+	}
+
+	want := "note over t2: table lock granted t1 (read), waiting t2 (intention exclusive)"
+	if !strings.Contains(mermaid, want) {
+		t.Errorf("expected %q in\n%v", want, mermaid)
+	}
+
+	if got := events[2].Observed; got != "0" {
+		t.Errorf("got %v, want %v", got, "0")
+	}
+
+	if got := table.Data["x"].Committed; got != "2" {
+		t.Errorf("got %v, want %v", got, "2")
+	}
+}
+
+func TestLockTableWaitsForRowWriters(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "0")
+
+	NewTwoPhaseLocking("t1", &table).Set("x", "1")
+
+	locker := NewTwoPhaseLocking("t2", &table)
+	locker.GetLocks().SetLockTimeout(10 * time.Millisecond)
+
+	want := "canceling statement due to lock timeout on table"
+	var timeoutErr *LockTimeoutError
+	if err := locker.TryLockTable(Read); !errors.As(err, &timeoutErr) || err.Error() != want {
+		t.Errorf("got %v, want %v", err, want)
+	}
+}
+
+func TestLockEscalation(t *testing.T) {
+	table := NewTable()
+	table.LockEscalationThreshold = 2
+	for _, key := range []Key{"x", "y", "z"} {
+		table.Data[key] = NewRow(key, "0")
+	}
+
+	tx := NewTwoPhaseLocking("t1", &table)
+	for _, key := range []Key{"x", "y", "z"} {
+		tx.Get(key)
+	}
+
+	if got := tx.GetLocks().GetLockLevels(); len(got) != 0 {
+		t.Errorf("expected the row locks to be released, got %v", got)
+	}
+
+	want := LockQueue{Granted: []QueuedRequest{{TxId: "t1", LockLevel: Read}}, Waiting: []QueuedRequest{}}
+	if got := table.TableLockQueue(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if value, err := NewTwoPhaseLocking("t2", &table).TryGet("x"); value != "0" || err != nil {
+		t.Errorf("got %v, %v, want %v", value, err, "0")
+	}
+
+	writer := NewTwoPhaseLocking("t3", &table)
+	writer.GetLocks().SetLockTimeout(10 * time.Millisecond)
+
+	wantErr := "canceling statement due to lock timeout on table"
+	if err := writer.TrySet("z", "3"); err == nil || err.Error() != wantErr {
+		t.Errorf("got %v, want %v", err, wantErr)
+	}
+}
+
+func TestLockEscalationKeepsRowLocksWhileTableIsShared(t *testing.T) {
+	table := NewTable()
+	table.LockEscalationThreshold = 1
+	for _, key := range []Key{"w", "x", "y"} {
+		table.Data[key] = NewRow(key, "0")
+	}
+
+	NewTwoPhaseLocking("t1", &table).Set("w", "1")
+
+	tx := NewTwoPhaseLocking("t2", &table)
+	tx.Get("x")
+	tx.Get("y")
+
+	if err := tx.GetError(); err != nil {
+		t.Fatalf("expected t2 to read, got error: %v", err)
+	}
+
+	wantLevels := map[Key]LockLevel{"x": Read, "y": Read}
+	if got := tx.GetLocks().GetLockLevels(); !reflect.DeepEqual(got, wantLevels) {
+		t.Errorf("got %v, want %v", got, wantLevels)
+	}
+
+	want := "granted t1 (intention exclusive), t2 (intention shared), waiting none"
+	if got := table.TableLockQueue().String(); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
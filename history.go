@@ -0,0 +1,354 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// HistoryOperation is a read, write, commit or abort of a transaction, or a
+// scan of the keys from Key to End that found Rows.
+type HistoryOperation struct {
+	TxId          TransactionId
+	OperationType OperationType
+	Key           Key
+	Value         Value
+	End           Key
+	Rows          []KeyValue
+	// VersionTs orders the versions a commit installs among those of other
+	// commits, for transactions that do not install them in commit order.
+	VersionTs int
+	// InstalledOnWrite tells the write installed its version as it was made,
+	// other transactions may read and overwrite it before the writer commits.
+	InstalledOnWrite bool
+}
+
+func (o HistoryOperation) String() string {
+	switch o.OperationType {
+	case ReadOperation:
+		return fmt.Sprintf("%v:r(%v)=%v", o.TxId, o.Key, o.Value)
+	case WriteOperation:
+		if o.Value == TombstoneValue() {
+			return fmt.Sprintf("%v:d(%v)", o.TxId, o.Key)
+		}
+
+		return fmt.Sprintf("%v:w(%v)=%v", o.TxId, o.Key, o.Value)
+	case ScanOperation:
+		return fmt.Sprintf("%v:s(%v..%v)=%v", o.TxId, o.Key, o.End, o.Rows)
+	case Commit:
+		return fmt.Sprintf("%v:c", o.TxId)
+	default:
+		return fmt.Sprintf("%v:a", o.TxId)
+	}
+}
+
+// History is the order in which the operations of transactions took effect
+// on a table. Setting Table.History records every transaction created by
+// TransactionFromTransactionLevel, others can be wrapped in a
+// RecordedTransaction.
+type History struct {
+	mu         sync.Mutex
+	operations []HistoryOperation
+}
+
+func NewHistory() *History {
+	return &History{
+		mu:         sync.Mutex{},
+		operations: make([]HistoryOperation, 0),
+	}
+}
+
+func (h *History) record(operation HistoryOperation) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.operations = append(h.operations, operation)
+}
+
+func (h *History) GetOperations() []HistoryOperation {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return append([]HistoryOperation{}, h.operations...)
+}
+
+// itemOperations returns the operations with every scan replaced by reads of
+// the keys of its range written anywhere in the history, the ones it did not
+// find reading as EmptyValue(). That way inserting into or deleting from the
+// range conflicts with the scan like writing a key conflicts with reading it.
+func (h *History) itemOperations() []HistoryOperation {
+	operations := h.GetOperations()
+
+	written := make([]Key, 0)
+	for _, operation := range operations {
+		if operation.OperationType == WriteOperation && !slices.Contains(written, operation.Key) {
+			written = append(written, operation.Key)
+		}
+	}
+	slices.Sort(written)
+
+	res := make([]HistoryOperation, 0, len(operations))
+	for _, operation := range operations {
+		if operation.OperationType != ScanOperation {
+			res = append(res, operation)
+			continue
+		}
+
+		found := make(map[Key]Value)
+		keys := make([]Key, 0)
+		for _, row := range operation.Rows {
+			found[row.Key] = row.Value
+			keys = append(keys, row.Key)
+		}
+
+		for _, key := range written {
+			if _, ok := found[key]; !ok && isBetween(key, operation.Key, operation.End) {
+				found[key] = EmptyValue()
+				keys = append(keys, key)
+			}
+		}
+		slices.Sort(keys)
+
+		for _, key := range keys {
+			res = append(res, HistoryOperation{TxId: operation.TxId, OperationType: ReadOperation, Key: key, Value: found[key]})
+		}
+	}
+
+	return res
+}
+
+func (h *History) String() string {
+	res := make([]string, 0)
+
+	for _, operation := range h.GetOperations() {
+		res = append(res, operation.String())
+	}
+
+	return strings.Join(res, " ")
+}
+
+// RecordedTransaction records the operations of the transaction it wraps.
+// Refused operations are not recorded, only the abort they caused.
+type RecordedTransaction struct {
+	Transaction
+	txId      TransactionId
+	history   *History
+	isAborted bool
+}
+
+func NewRecordedTransaction(txId TransactionId, tx Transaction, history *History) *RecordedTransaction {
+	return &RecordedTransaction{
+		Transaction: tx,
+		txId:        txId,
+		history:     history,
+		isAborted:   false,
+	}
+}
+
+func (r *RecordedTransaction) recordOutcome(operationType OperationType, key Key, value Value, err error) {
+	if err == nil {
+		r.isAborted = false
+		r.history.record(HistoryOperation{
+			TxId:             r.txId,
+			OperationType:    operationType,
+			Key:              key,
+			Value:            value,
+			InstalledOnWrite: operationType == WriteOperation && r.installsOnWrite(),
+		})
+		return
+	}
+
+	r.recordFailure()
+}
+
+// dirtyWriting is implemented by the transactions whose uncommitted writes
+// replace the latest value of their row right away.
+type dirtyWriting interface {
+	installsOnWrite() bool
+}
+
+func (r *RecordedTransaction) installsOnWrite() bool {
+	if tx, ok := r.Transaction.(dirtyWriting); ok {
+		return tx.installsOnWrite()
+	}
+
+	return false
+}
+
+// versionOrdered is implemented by the transactions whose versions are not
+// ordered by commit, versionTs returns the timestamp ordering them.
+type versionOrdered interface {
+	versionTs() int
+}
+
+func (r *RecordedTransaction) versionTs() int {
+	if tx, ok := r.Transaction.(versionOrdered); ok {
+		return tx.versionTs()
+	}
+
+	return 0
+}
+
+func (r *RecordedTransaction) recordCommit(versionTs int, err error) {
+	if err == nil {
+		r.isAborted = false
+		r.history.record(HistoryOperation{TxId: r.txId, OperationType: Commit, Key: EmptyKey(), Value: EmptyValue(), VersionTs: versionTs})
+		return
+	}
+
+	r.recordFailure()
+}
+
+// recordFailure records the abort a refused operation caused, if any.
+func (r *RecordedTransaction) recordFailure() {
+	status := r.Transaction.GetStatus()
+	if status == AbortedStatus || status == RolledBackStatus {
+		r.recordAbort()
+	}
+}
+
+func (r *RecordedTransaction) recordAbort() {
+	if r.isAborted {
+		return
+	}
+
+	r.isAborted = true
+	r.history.record(HistoryOperation{TxId: r.txId, OperationType: Rollback, Key: EmptyKey(), Value: EmptyValue()})
+}
+
+func (r *RecordedTransaction) TrySet(key Key, value Value) error {
+	err := r.Transaction.TrySet(key, value)
+	r.recordOutcome(WriteOperation, key, value, err)
+	return err
+}
+
+func (r *RecordedTransaction) TryDelete(key Key) error {
+	err := r.Transaction.TryDelete(key)
+	r.recordOutcome(WriteOperation, key, TombstoneValue(), err)
+	return err
+}
+
+func (r *RecordedTransaction) TryGet(key Key) (Value, error) {
+	value, err := r.Transaction.TryGet(key)
+	r.recordOutcome(ReadOperation, key, value, err)
+	return value, err
+}
+
+func (r *RecordedTransaction) TryScan(from Key, to Key) ([]KeyValue, error) {
+	rows, err := r.Transaction.TryScan(from, to)
+	r.recordScan(from, to, rows, err)
+	return rows, err
+}
+
+func (r *RecordedTransaction) recordScan(from Key, to Key, rows []KeyValue, err error) {
+	if err != nil {
+		r.recordFailure()
+		return
+	}
+
+	r.isAborted = false
+	r.history.record(HistoryOperation{TxId: r.txId, OperationType: ScanOperation, Key: from, Value: EmptyValue(), End: to, Rows: rows})
+}
+
+func (r *RecordedTransaction) TryLock(key Key) error {
+	err := r.Transaction.TryLock(key)
+	if err != nil {
+		r.recordFailure()
+	}
+	return err
+}
+
+func (r *RecordedTransaction) TryLockWith(key Key, mode LockMode) (bool, error) {
+	isLocked, err := r.Transaction.TryLockWith(key, mode)
+	if err != nil {
+		r.recordFailure()
+	}
+	return isLocked, err
+}
+
+func (r *RecordedTransaction) TryLockTable(lockLevel LockLevel) error {
+	err := r.Transaction.TryLockTable(lockLevel)
+	if err != nil {
+		r.recordFailure()
+	}
+	return err
+}
+
+func (r *RecordedTransaction) TryRollback() error {
+	err := r.Transaction.TryRollback()
+	if err == nil {
+		r.recordAbort()
+	}
+	return err
+}
+
+func (r *RecordedTransaction) TryCommit() error {
+	versionTs := r.versionTs()
+	err := r.Transaction.TryCommit()
+	r.recordCommit(versionTs, err)
+	return err
+}
+
+func (r *RecordedTransaction) Set(key Key, value Value) Transaction {
+	r.Transaction.Set(key, value)
+	r.recordOutcome(WriteOperation, key, value, r.Transaction.GetError())
+	return r
+}
+
+func (r *RecordedTransaction) Delete(key Key) Transaction {
+	r.Transaction.Delete(key)
+	r.recordOutcome(WriteOperation, key, TombstoneValue(), r.Transaction.GetError())
+	return r
+}
+
+func (r *RecordedTransaction) Get(key Key) Value {
+	value := r.Transaction.Get(key)
+	r.recordOutcome(ReadOperation, key, value, r.Transaction.GetError())
+	return value
+}
+
+func (r *RecordedTransaction) Scan(from Key, to Key) []KeyValue {
+	rows := r.Transaction.Scan(from, to)
+	r.recordScan(from, to, rows, r.Transaction.GetError())
+	return rows
+}
+
+func (r *RecordedTransaction) Lock(key Key) Transaction {
+	r.Transaction.Lock(key)
+	if r.Transaction.GetError() != nil {
+		r.recordFailure()
+	}
+	return r
+}
+
+func (r *RecordedTransaction) LockWith(key Key, mode LockMode) Transaction {
+	r.Transaction.LockWith(key, mode)
+	if r.Transaction.GetError() != nil {
+		r.recordFailure()
+	}
+	return r
+}
+
+func (r *RecordedTransaction) LockTable(lockLevel LockLevel) Transaction {
+	r.Transaction.LockTable(lockLevel)
+	if r.Transaction.GetError() != nil {
+		r.recordFailure()
+	}
+	return r
+}
+
+func (r *RecordedTransaction) Rollback() Transaction {
+	r.Transaction.Rollback()
+	if r.Transaction.GetError() == nil {
+		r.recordAbort()
+	}
+	return r
+}
+
+func (r *RecordedTransaction) Commit() Transaction {
+	versionTs := r.versionTs()
+	r.Transaction.Commit()
+	r.recordCommit(versionTs, r.Transaction.GetError())
+	return r
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func playWriteSkew(t *testing.T, level TransactionLevel) *History {
+	table := NewTable()
+	table.Data["doctor-a-is-on-call"] = NewRow("doctor-a-is-on-call", "true")
+	table.Data["doctor-b-is-on-call"] = NewRow("doctor-b-is-on-call", "true")
+	table.History = NewHistory()
+
+	events := []Event{
+		NewRead("doctor-a", level, "doctor-b-is-on-call"),
+		NewRead("doctor-b", level, "doctor-a-is-on-call"),
+		NewWrite("doctor-a", level, "doctor-a-is-on-call", "false"),
+		NewWrite("doctor-b", level, "doctor-b-is-on-call", "false"),
+		NewCommit("doctor-a", level),
+		NewCommit("doctor-b", level),
+	}
+
+	if _, err := PlayEvents(events, &table); err != nil {
+		t.Fatalf("expected PlayEvents to succeed, got error: %v", err)
+	}
+
+	return table.History
+}
+
+func TestHistoryRecordsOperations(t *testing.T) {
+	history := playWriteSkew(t, SnapshotIsolationLevel)
+
+	want := "doctor-a:r(doctor-b-is-on-call)=true doctor-b:r(doctor-a-is-on-call)=true " +
+		"doctor-a:w(doctor-a-is-on-call)=false doctor-b:w(doctor-b-is-on-call)=false " +
+		"doctor-a:c doctor-b:c"
+
+	if history.String() != want {
+		t.Errorf("got %v, want %v", history.String(), want)
+	}
+}
+
+func TestWriteSkewIsNotConflictSerializable(t *testing.T) {
+	_, err := playWriteSkew(t, SnapshotIsolationLevel).CheckConflictSerializable()
+
+	var notSerializableErr *NotConflictSerializableError
+	if !errors.As(err, &notSerializableErr) {
+		t.Fatalf("got %v, want not conflict serializable error", err)
+	}
+
+	want := "history is not conflict serializable, doctor-a -rw(doctor-b-is-on-call)-> doctor-b -rw(doctor-a-is-on-call)-> doctor-a"
+	if err.Error() != want {
+		t.Errorf("got %v, want %v", err.Error(), want)
+	}
+}
+
+func TestAbortedTransactionsAreLeftOutOfTheSerializationGraph(t *testing.T) {
+	history := playWriteSkew(t, SerializableSnapshotIsolationLevel)
+
+	order, err := history.CheckConflictSerializable()
+	if err != nil {
+		t.Fatalf("got %v, want the history to be conflict serializable", err)
+	}
+
+	want := []TransactionId{"doctor-a"}
+	if !slices.Equal(order, want) {
+		t.Errorf("got %v, want %v", order, want)
+	}
+}
+
+func TestRecordedTransactionFindsSerialOrder(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "1")
+	history := NewHistory()
+
+	t1 := NewRecordedTransaction("1", NewReadCommitted("1", &table), history)
+	t2 := NewRecordedTransaction("2", NewReadCommitted("2", &table), history)
+
+	t2.Get("x")
+	t1.Set("x", "2").Commit()
+	t2.Commit()
+
+	order, err := history.CheckConflictSerializable()
+	if err != nil {
+		t.Fatalf("got %v, want the history to be conflict serializable", err)
+	}
+
+	want := []TransactionId{"2", "1"}
+	if !slices.Equal(order, want) {
+		t.Errorf("got %v, want %v", order, want)
+	}
+}
+
+func TestStaleReadLostUpdateIsNotConflictSerializable(t *testing.T) {
+	history := NewHistory()
+	for _, operation := range []HistoryOperation{
+		{TxId: "t2", OperationType: WriteOperation, Key: "x", Value: "2"},
+		{TxId: "t2", OperationType: Commit},
+		{TxId: "t1", OperationType: ReadOperation, Key: "x", Value: "1"},
+		{TxId: "t1", OperationType: WriteOperation, Key: "x", Value: "1+1"},
+		{TxId: "t1", OperationType: Commit},
+	} {
+		history.record(operation)
+	}
+
+	_, err := history.CheckConflictSerializable()
+
+	want := "history is not conflict serializable, t2 -ww(x)-> t1 -rw(x)-> t2"
+	if err == nil || err.Error() != want {
+		t.Errorf("got %v, want %v", err, want)
+	}
+}
@@ -0,0 +1,451 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// lockRequest asks for a lock for a transaction. A conversion asks for a
+// write lock while holding the read lock, which it keeps while waiting. A
+// request with a deadline gives up waiting on its own.
+type lockRequest struct {
+	txId         TransactionId
+	lockLevel    LockLevel
+	isConversion bool
+	hasDeadline  bool
+	ready        chan struct{}
+	err          error
+}
+
+type DeadlockPolicy int
+
+const (
+	DeadlockDetection DeadlockPolicy = iota
+	WoundWait
+	WaitDie
+)
+
+func (p DeadlockPolicy) String() string {
+	switch p {
+	case DeadlockDetection:
+		return "deadlock detection"
+	case WoundWait:
+		return "wound-wait"
+	case WaitDie:
+		return "wait-die"
+	default:
+		return fmt.Sprintf("DeadlockPolicy(%d)", int(p))
+	}
+}
+
+// LockManager hands out row locks in the order they were requested, a request
+// waits for the owners it conflicts with and for the conflicting requests
+// queued before it, so readers cannot starve a writer. It keeps a wait-for
+// graph of these waits. With DeadlockDetection a transaction whose wait would
+// close a cycle in the graph is the deadlock victim and gets a DeadlockError
+// instead of waiting. WoundWait and WaitDie prevent deadlocks instead,
+// comparing the age of the requester and the transactions it would wait for
+// whenever a request would block.
+type LockManager struct {
+	mu        sync.Mutex
+	policy    DeadlockPolicy
+	ages      map[TransactionId]int
+	wounded   map[TransactionId]error
+	aborts    int
+	waitsFor  map[TransactionId]map[TransactionId]struct{}
+	waitingOn map[TransactionId]*TrackableRWMutex
+	observer  LockWaitObserver
+}
+
+// LockWaitObserver is told when a transaction starts waiting for a lock, and
+// again from the waiting goroutine once the wait is over, before Acquire
+// returns. Resumed may block to hold the transaction back.
+type LockWaitObserver interface {
+	Waiting(txId TransactionId)
+	Resumed(txId TransactionId)
+}
+
+func NewLockManager() *LockManager {
+	return &LockManager{
+		mu:        sync.Mutex{},
+		policy:    DeadlockDetection,
+		ages:      make(map[TransactionId]int),
+		wounded:   make(map[TransactionId]error),
+		aborts:    0,
+		waitsFor:  make(map[TransactionId]map[TransactionId]struct{}),
+		waitingOn: make(map[TransactionId]*TrackableRWMutex),
+		observer:  nil,
+	}
+}
+
+func (m *LockManager) SetDeadlockPolicy(policy DeadlockPolicy) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.policy = policy
+}
+
+func (m *LockManager) SetObserver(observer LockWaitObserver) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.observer = observer
+}
+
+// RegisterTransaction gives txId the next timestamp unless it already has
+// one, transactions that first lock earlier are older.
+func (m *LockManager) RegisterTransaction(txId TransactionId) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.register(txId)
+}
+
+func (m *LockManager) register(txId TransactionId) {
+	if _, ok := m.ages[txId]; ok {
+		return
+	}
+
+	m.ages[txId] = len(m.ages)
+}
+
+func (m *LockManager) isOlder(txId, otherTxId TransactionId) bool {
+	return m.ages[txId] < m.ages[otherTxId]
+}
+
+// Acquire grants lockLevel on mutex to txId, waiting for the owners to
+// release it if needed. It reports whether txId had to wait. Asking for a
+// write lock while holding the read lock upgrades it without releasing it, two
+// transactions upgrading the same lock deadlock.
+func (m *LockManager) Acquire(txId TransactionId, mutex *TrackableRWMutex, lockLevel LockLevel) (bool, error) {
+	return m.AcquireContext(context.Background(), txId, mutex, lockLevel)
+}
+
+// AcquireContext is Acquire giving up the wait once ctx is done, with the
+// cause of ctx as the error.
+func (m *LockManager) AcquireContext(ctx context.Context, txId TransactionId, mutex *TrackableRWMutex, lockLevel LockLevel) (bool, error) {
+	m.mu.Lock()
+	m.register(txId)
+
+	if err, ok := m.wounded[txId]; ok {
+		delete(m.wounded, txId)
+		m.mu.Unlock()
+		return false, err
+	}
+
+	_, hasDeadline := ctx.Deadline()
+	request := &lockRequest{
+		txId:         txId,
+		lockLevel:    lockLevel,
+		isConversion: mutex.isHeldBy(txId),
+		hasDeadline:  hasDeadline,
+		ready:        make(chan struct{}),
+		err:          nil,
+	}
+
+	blockers := mutex.blockers(txId, lockLevel)
+	if len(blockers) == 0 {
+		mutex.grant(request)
+		m.mu.Unlock()
+		return false, nil
+	}
+
+	for _, owner := range blockers {
+		switch {
+		case m.policy == WaitDie && m.isOlder(owner, txId):
+			m.aborts++
+			m.mu.Unlock()
+			return false, &DeadlockPreventionError{TxId: txId, Policy: WaitDie, Older: owner}
+		case m.policy == WoundWait && m.isOlder(txId, owner):
+			m.wound(owner, txId)
+		}
+	}
+
+	mutex.enqueue(request)
+
+	m.waitingOn[txId] = mutex
+	m.updateWaitsFor(mutex)
+
+	if cycle, ok := m.findCycle(txId); m.policy == DeadlockDetection && ok {
+		m.stopWaiting(mutex, request)
+		m.aborts++
+		m.mu.Unlock()
+		return false, &DeadlockError{TxId: txId, Cycle: cycle}
+	}
+
+	observer := m.observer
+	if observer != nil {
+		observer.Waiting(txId)
+	}
+
+	m.mu.Unlock()
+
+	select {
+	case <-request.ready:
+	case <-ctx.Done():
+		m.giveUp(mutex, request, context.Cause(ctx))
+	}
+
+	if observer != nil {
+		observer.Resumed(txId)
+	}
+
+	return true, request.err
+}
+
+// TryAcquire grants lockLevel on mutex to txId only if it can do so right
+// away, it reports whether it did.
+func (m *LockManager) TryAcquire(txId TransactionId, mutex *TrackableRWMutex, lockLevel LockLevel) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.register(txId)
+
+	if err, ok := m.wounded[txId]; ok {
+		delete(m.wounded, txId)
+		return false, err
+	}
+
+	if len(mutex.blockers(txId, lockLevel)) > 0 {
+		return false, nil
+	}
+
+	mutex.grant(&lockRequest{
+		txId:         txId,
+		lockLevel:    lockLevel,
+		isConversion: mutex.isHeldBy(txId),
+		hasDeadline:  false,
+		ready:        make(chan struct{}),
+		err:          nil,
+	})
+
+	return true, nil
+}
+
+// wound aborts the younger owner of a lock an older transaction asks for.
+// A waiting owner is woken up with the error right away, others get it on
+// their next lock request or when they try to commit.
+func (m *LockManager) wound(txId TransactionId, olderTxId TransactionId) {
+	err := &DeadlockPreventionError{TxId: txId, Policy: WoundWait, Older: olderTxId}
+	m.aborts++
+
+	if !m.interrupt(txId, err) {
+		m.wounded[txId] = err
+	}
+}
+
+// Interrupt stops the wait of txId for a lock, if it waits for one, with err.
+func (m *LockManager) Interrupt(txId TransactionId, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.interrupt(txId, err)
+}
+
+func (m *LockManager) interrupt(txId TransactionId, err error) bool {
+	mutex, isWaiting := m.waitingOn[txId]
+	if !isWaiting {
+		return false
+	}
+
+	for _, request := range mutex.waiters {
+		if request.txId == txId {
+			m.stopWaiting(mutex, request)
+			m.grantWaiters(mutex)
+			request.err = err
+			close(request.ready)
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasWaitDeadline tells whether txId waits for a lock with a deadline, its
+// wait then ends even if the lock is never released.
+func (m *LockManager) HasWaitDeadline(txId TransactionId) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mutex, isWaiting := m.waitingOn[txId]
+	if !isWaiting {
+		return false
+	}
+
+	for _, request := range mutex.waiters {
+		if request.txId == txId {
+			return request.hasDeadline
+		}
+	}
+
+	return false
+}
+
+// giveUp stops the wait of a request with err, unless the request was granted
+// or woken up meanwhile.
+func (m *LockManager) giveUp(mutex *TrackableRWMutex, request *lockRequest, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	select {
+	case <-request.ready:
+		return
+	default:
+	}
+
+	m.stopWaiting(mutex, request)
+	m.grantWaiters(mutex)
+	request.err = err
+	close(request.ready)
+}
+
+// TakeWound returns the wound txId got since its last lock request, if any,
+// and clears it.
+func (m *LockManager) TakeWound(txId TransactionId) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	err, ok := m.wounded[txId]
+	if !ok {
+		return nil
+	}
+
+	delete(m.wounded, txId)
+
+	return err
+}
+
+// Forget drops the wound of a transaction that rolled back before it noticed,
+// it still counts as aborted.
+func (m *LockManager) Forget(txId TransactionId) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.wounded, txId)
+}
+
+func (m *LockManager) Release(txId TransactionId, mutex *TrackableRWMutex, lockLevel LockLevel) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mutex.release(txId, lockLevel)
+	m.grantWaiters(mutex)
+}
+
+// grantWaiters grants the waiting requests in order, as long as they do not
+// conflict with the granted group nor with the requests before them.
+func (m *LockManager) grantWaiters(mutex *TrackableRWMutex) {
+	for _, request := range append([]*lockRequest{}, mutex.waiters...) {
+		if len(mutex.blockers(request.txId, request.lockLevel)) > 0 {
+			continue
+		}
+
+		mutex.grant(request)
+		m.stopWaiting(mutex, request)
+		close(request.ready)
+	}
+
+	m.updateWaitsFor(mutex)
+}
+
+func (m *LockManager) stopWaiting(mutex *TrackableRWMutex, request *lockRequest) {
+	mutex.stateMu.Lock()
+	for i, waiter := range mutex.waiters {
+		if waiter == request {
+			mutex.waiters = append(mutex.waiters[:i], mutex.waiters[i+1:]...)
+			break
+		}
+	}
+	mutex.stateMu.Unlock()
+
+	delete(m.waitingOn, request.txId)
+	delete(m.waitsFor, request.txId)
+}
+
+func (m *LockManager) updateWaitsFor(mutex *TrackableRWMutex) {
+	for _, request := range mutex.waiters {
+		owners := make(map[TransactionId]struct{})
+		for _, blocker := range mutex.blockers(request.txId, request.lockLevel) {
+			owners[blocker] = struct{}{}
+		}
+
+		m.waitsFor[request.txId] = owners
+	}
+}
+
+// findCycle walks the wait-for graph from txId and returns the path back to
+// txId, starting and ending with it.
+func (m *LockManager) findCycle(txId TransactionId) ([]TransactionId, bool) {
+	visited := make(map[TransactionId]struct{})
+
+	var walk func(current TransactionId, path []TransactionId) ([]TransactionId, bool)
+	walk = func(current TransactionId, path []TransactionId) ([]TransactionId, bool) {
+		for _, owner := range sortedTransactionIds(m.waitsFor[current]) {
+			if owner == txId {
+				return append(path, owner), true
+			}
+
+			if _, ok := visited[owner]; ok {
+				continue
+			}
+			visited[owner] = struct{}{}
+
+			if cycle, ok := walk(owner, append(path, owner)); ok {
+				return cycle, true
+			}
+		}
+
+		return nil, false
+	}
+
+	return walk(txId, []TransactionId{txId})
+}
+
+func (m *LockManager) GetWaitsFor() map[TransactionId][]TransactionId {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	res := make(map[TransactionId][]TransactionId)
+	for txId, owners := range m.waitsFor {
+		res[txId] = sortedTransactionIds(owners)
+	}
+
+	return res
+}
+
+func (m *LockManager) GetAborts() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.aborts
+}
+
+func (m *LockManager) IsWaiting(txId TransactionId) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.waitingOn[txId]
+	return ok
+}
+
+// IsWaitingOn tells whether txId waits for mutex.
+func (m *LockManager) IsWaitingOn(txId TransactionId, mutex *TrackableRWMutex) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.waitingOn[txId] == mutex
+}
+
+func sortedTransactionIds(txIds map[TransactionId]struct{}) []TransactionId {
+	res := make([]TransactionId, 0)
+
+	for txId := range txIds {
+		res = append(res, txId)
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i] < res[j] })
+
+	return res
+}
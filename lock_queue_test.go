@@ -0,0 +1,108 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func acquireInBackground(lockManager *LockManager, txId TransactionId, mutex *TrackableRWMutex, lockLevel LockLevel) chan error {
+	done := make(chan error, 1)
+
+	go func() {
+		_, err := lockManager.Acquire(txId, mutex, lockLevel)
+		done <- err
+	}()
+
+	for !lockManager.IsWaiting(txId) {
+		time.Sleep(time.Millisecond)
+	}
+
+	return done
+}
+
+func TestLockQueueKeepsReadersFromOvertakingWriter(t *testing.T) {
+	lockManager := NewLockManager()
+	mutex := NewTrackableRWMutex()
+
+	if _, err := lockManager.Acquire("t1", mutex, Read); err != nil {
+		t.Fatalf("expected t1 to get the lock, got error: %v", err)
+	}
+
+	writerDone := acquireInBackground(lockManager, "t2", mutex, ReadWrite)
+	readerDone := acquireInBackground(lockManager, "t3", mutex, Read)
+
+	want := LockQueue{
+		Granted: []QueuedRequest{{TxId: "t1", LockLevel: Read}},
+		Waiting: []QueuedRequest{{TxId: "t2", LockLevel: ReadWrite}, {TxId: "t3", LockLevel: Read}},
+	}
+	if got := mutex.Queue(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	wantWaitsFor := map[TransactionId][]TransactionId{"t2": {"t1"}, "t3": {"t2"}}
+	if got := lockManager.GetWaitsFor(); !reflect.DeepEqual(got, wantWaitsFor) {
+		t.Errorf("got %v, want %v", got, wantWaitsFor)
+	}
+
+	lockManager.Release("t1", mutex, Read)
+	if err := <-writerDone; err != nil {
+		t.Fatalf("expected t2 to get the lock, got error: %v", err)
+	}
+
+	want = LockQueue{
+		Granted: []QueuedRequest{{TxId: "t2", LockLevel: ReadWrite}},
+		Waiting: []QueuedRequest{{TxId: "t3", LockLevel: Read}},
+	}
+	if got := mutex.Queue(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	lockManager.Release("t2", mutex, ReadWrite)
+	if err := <-readerDone; err != nil {
+		t.Fatalf("expected t3 to get the lock, got error: %v", err)
+	}
+}
+
+func TestLockQueueGrantsReadersTogether(t *testing.T) {
+	lockManager := NewLockManager()
+	mutex := NewTrackableRWMutex()
+
+	if _, err := lockManager.Acquire("t1", mutex, ReadWrite); err != nil {
+		t.Fatalf("expected t1 to get the lock, got error: %v", err)
+	}
+
+	firstDone := acquireInBackground(lockManager, "t2", mutex, Read)
+	secondDone := acquireInBackground(lockManager, "t3", mutex, Read)
+
+	lockManager.Release("t1", mutex, ReadWrite)
+	<-firstDone
+	<-secondDone
+
+	want := "granted t2 (read), t3 (read), waiting none"
+	if got := mutex.Queue().String(); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestPlayEventsGrantsLocksInOrder(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "0")
+
+	events := []Event{
+		NewRead("t1", TwoPhaseLockingLevel, "x"),
+		NewWrite("t2", TwoPhaseLockingLevel, "x", "2"),
+		NewRead("t3", TwoPhaseLockingLevel, "x"),
+		NewCommit("t1", TwoPhaseLockingLevel),
+		NewCommit("t2", TwoPhaseLockingLevel),
+		NewCommit("t3", TwoPhaseLockingLevel),
+	}
+
+	if _, err := PlayEvents(events, &table); err != nil {
+		t.Fatalf("expected PlayEvents to succeed, got error: %v", err)
+	}
+
+	if got := events[2].Observed; got != "2" {
+		t.Errorf("got %v, want %v", got, "2")
+	}
+}
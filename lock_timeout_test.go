@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLockTimeout(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "0")
+
+	owner := NewTwoPhaseLocking("t1", &table)
+	owner.Set("x", "1")
+
+	waiter := NewTwoPhaseLocking("t2", &table)
+	waiter.GetLocks().SetLockTimeout(10 * time.Millisecond)
+
+	want := "canceling statement due to lock timeout on x"
+	var timeoutErr *LockTimeoutError
+	if err := waiter.TrySet("x", "2"); !errors.As(err, &timeoutErr) || err.Error() != want {
+		t.Fatalf("got %v, want %v", err, want)
+	}
+
+	if status := waiter.GetStatus(); status != AbortedStatus {
+		t.Errorf("got %v, want %v", status, AbortedStatus)
+	}
+
+	if waitsFor := table.LockManager.GetWaitsFor(); len(waitsFor) != 0 {
+		t.Errorf("expected nobody to wait anymore, got %v", waitsFor)
+	}
+
+	owner.Commit()
+	waiter.Rollback().Set("x", "2").Commit()
+
+	if err := waiter.GetError(); err != nil {
+		t.Fatalf("expected the retry to commit, got error: %v", err)
+	}
+
+	if got := table.Data["x"].Committed; got != "2" {
+		t.Errorf("got %v, want %v", got, "2")
+	}
+}
+
+func TestLockTimeoutOnRange(t *testing.T) {
+	table := NewTable()
+
+	scanner := NewTwoPhaseLocking("t1", &table)
+	scanner.Scan("a", "z")
+
+	inserter := NewTwoPhaseLocking("t2", &table)
+	inserter.GetLocks().SetLockTimeout(10 * time.Millisecond)
+
+	want := "canceling statement due to lock timeout on a..z"
+	if err := inserter.TrySet("y", "1"); err == nil || err.Error() != want {
+		t.Errorf("got %v, want %v", err, want)
+	}
+}
+
+func TestLockWaitCanceledByContext(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "0")
+
+	NewTwoPhaseLocking("t1", &table).Set("x", "1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	waiter := NewTwoPhaseLocking("t2", &table)
+	waiter.GetLocks().SetContext(ctx)
+
+	if _, err := waiter.TryGet("x"); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want %v", err, context.Canceled)
+	}
+
+	if table.LockManager.IsWaiting("t2") {
+		t.Errorf("expected t2 to stop waiting")
+	}
+}
+
+func TestLockGrantedBeforeTimeout(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "0")
+
+	owner := NewTwoPhaseLocking("t1", &table)
+	owner.Set("x", "1")
+
+	go func() {
+		for !table.LockManager.IsWaiting("t2") {
+			time.Sleep(time.Millisecond)
+		}
+		owner.Commit()
+	}()
+
+	waiter := NewTwoPhaseLocking("t2", &table)
+	waiter.GetLocks().SetLockTimeout(time.Minute)
+
+	if value, err := waiter.TryGet("x"); err != nil || value != "1" {
+		t.Errorf("got %v, %v, want %v", value, err, "1")
+	}
+}
+
+func TestSchedulerWaitsForLockTimeoutAfterLastStep(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "0")
+
+	scheduler := NewScheduler(table.LockManager)
+	table.LockManager.SetObserver(scheduler)
+
+	owner := NewTwoPhaseLocking("t1", &table)
+	waiter := NewTwoPhaseLocking("t2", &table)
+	waiter.GetLocks().SetLockTimeout(10 * time.Millisecond)
+
+	var waitErr error
+	scheduler.Schedule("t1", func() { owner.Set("x", "1") }, func() {})
+	scheduler.Schedule("t2", func() { waitErr = waiter.TrySet("x", "2") }, func() {})
+
+	if err := scheduler.Wait(); err != nil {
+		t.Fatalf("expected the wait to time out, got error: %v", err)
+	}
+
+	var timeoutErr *LockTimeoutError
+	if !errors.As(waitErr, &timeoutErr) {
+		t.Errorf("got %v, want lock timeout error", waitErr)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUpgradeKeepsReadLockWhileWaiting(t *testing.T) {
+	lockManager := NewLockManager()
+	mutex := NewTrackableRWMutex()
+
+	for _, txId := range []TransactionId{"t1", "t2"} {
+		if _, err := lockManager.Acquire(txId, mutex, Read); err != nil {
+			t.Fatalf("expected %v to get the lock, got error: %v", txId, err)
+		}
+	}
+
+	writerDone := acquireInBackground(lockManager, "t3", mutex, ReadWrite)
+	upgradeDone := acquireInBackground(lockManager, "t1", mutex, ReadWrite)
+
+	want := LockQueue{
+		Granted: []QueuedRequest{{TxId: "t1", LockLevel: Read}, {TxId: "t2", LockLevel: Read}},
+		Waiting: []QueuedRequest{{TxId: "t1", LockLevel: ReadWrite}, {TxId: "t3", LockLevel: ReadWrite}},
+	}
+	if got := mutex.Queue(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	lockManager.Release("t2", mutex, Read)
+	if err := <-upgradeDone; err != nil {
+		t.Fatalf("expected t1 to upgrade its lock, got error: %v", err)
+	}
+
+	want = LockQueue{
+		Granted: []QueuedRequest{{TxId: "t1", LockLevel: ReadWrite}},
+		Waiting: []QueuedRequest{{TxId: "t3", LockLevel: ReadWrite}},
+	}
+	if got := mutex.Queue(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	lockManager.Release("t1", mutex, ReadWrite)
+	if err := <-writerDone; err != nil {
+		t.Fatalf("expected t3 to get the lock, got error: %v", err)
+	}
+}
+
+func TestTwoUpgradersDeadlockIsReported(t *testing.T) {
+	tests := []struct {
+		policy  DeadlockPolicy
+		wantErr string
+	}{
+		{policy: DeadlockDetection, wantErr: "deadlock detected, t2 waits for t1 waits for t2"},
+		{policy: WaitDie, wantErr: "t2 dies waiting for older transaction t1"},
+		{policy: WoundWait, wantErr: "t2 was wounded by older transaction t1"},
+	}
+
+	for _, tt := range tests {
+		table := NewTable()
+		table.Data["x"] = NewRow("x", "0")
+		table.LockManager.SetDeadlockPolicy(tt.policy)
+
+		events := []Event{
+			NewRead("t1", TwoPhaseLockingLevel, "x"),
+			NewRead("t2", TwoPhaseLockingLevel, "x"),
+			NewWrite("t1", TwoPhaseLockingLevel, "x", "1"),
+			NewWrite("t2", TwoPhaseLockingLevel, "x", "2"),
+			NewCommit("t1", TwoPhaseLockingLevel),
+			NewRollback("t2", TwoPhaseLockingLevel),
+		}
+
+		if _, err := PlayEvents(events, &table); err != nil {
+			t.Fatalf("%v: expected PlayEvents to succeed, got error: %v", tt.policy, err)
+		}
+
+		gotErr := ""
+		if events[3].Err != nil {
+			gotErr = events[3].Err.Error()
+		}
+
+		if gotErr != tt.wantErr {
+			t.Errorf("%v: got %v, want %v", tt.policy, gotErr, tt.wantErr)
+		}
+
+		if got := table.Data["x"].Committed; got != "1" {
+			t.Errorf("%v: got %v, want %v", tt.policy, got, "1")
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLostUpdate(t *testing.T) {
+	for _, level := range []TransactionLevel{SnapshotIsolationLevel, SerializableSnapshotIsolationLevel} {
+		table := NewTable()
+		table.Data["counter"] = NewRow("counter", "1")
+
+		txPair := make([]Transaction, 0)
+		for _, txId := range []TransactionId{"1", "2"} {
+			tx, err := TransactionFromTransactionLevel(level, txId, &table)
+			if err != nil {
+				t.Fatalf("expected %v to start, got error: %v", level, err)
+			}
+
+			txPair = append(txPair, tx)
+		}
+
+		testLostUpdate(t, txPair)
+	}
+}
+
+func testLostUpdate(t *testing.T, txPair []Transaction) {
+	t1 := txPair[0]
+	t2 := txPair[1]
+
+	t1Counter := t1.Get("counter")
+	t2Counter := t2.Get("counter")
+
+	t1.Set("counter", t1Counter+"+1")
+	t2.Set("counter", t2Counter+"+1")
+
+	if err := t1.Commit().GetError(); err != nil {
+		t.Errorf("got %v, want first committer to win", err)
+	}
+
+	if err := t2.Commit().GetError(); !errors.Is(err, ErrConcurrentUpdate) {
+		t.Errorf("got %v, want %v", err, ErrConcurrentUpdate)
+	}
+
+	counter := t1.Get("counter")
+	if counter != "1+1" {
+		t.Errorf("got %v, want %v", counter, "1+1")
+	}
+}
+
+func TestLostUpdateAfterConcurrentCommit(t *testing.T) {
+	tests := []struct {
+		level        TransactionLevel
+		wantObserved Value
+		wantErr      error
+		wantCounter  Value
+	}{
+		// reading from its snapshot t1 misses the increment of t2, first
+		// committer wins aborts it
+		{level: SnapshotIsolationLevel, wantObserved: "0", wantErr: ErrConcurrentUpdate, wantCounter: "1"},
+		// reading the latest committed value under its lock t1 sees it
+		{level: TwoPhaseLockingLevel, wantObserved: "1", wantErr: nil, wantCounter: "1+1"},
+	}
+
+	for _, tt := range tests {
+		table := NewTable()
+		table.Data["counter"] = NewRow("counter", "0")
+		table.Data["other"] = NewRow("other", "0")
+
+		events := []Event{
+			NewRead("t1", tt.level, "other"),
+			NewRead("t2", tt.level, "counter"),
+			NewWrite("t2", tt.level, "counter", "1"),
+			NewCommit("t2", tt.level),
+			NewRead("t1", tt.level, "counter"),
+			NewWrite("t1", tt.level, "counter", tt.wantObserved+"+1"),
+			NewCommit("t1", tt.level),
+		}
+
+		if _, err := PlayEvents(events, &table); err != nil {
+			t.Fatalf("%v: expected PlayEvents to succeed, got error: %v", tt.level, err)
+		}
+
+		if got := events[4].Observed; got != tt.wantObserved {
+			t.Errorf("%v: got %v, want %v", tt.level, got, tt.wantObserved)
+		}
+
+		if err := events[6].Err; !errors.Is(err, tt.wantErr) {
+			t.Errorf("%v: got %v, want %v", tt.level, err, tt.wantErr)
+		}
+
+		if got := table.Data["counter"].Committed; got != tt.wantCounter {
+			t.Errorf("%v: got %v, want %v", tt.level, got, tt.wantCounter)
+		}
+	}
+}
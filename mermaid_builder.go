@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"strings"
 	"sync"
 )
 
@@ -18,6 +19,7 @@ type ArrowType int
 const (
 	Solid ArrowType = iota
 	Dotted
+	Cross
 )
 
 type ArrowMaterialization int
@@ -91,6 +93,8 @@ func (builder *MermaidBuilder) AddArrow(arrowType ArrowType, from, to, descripti
 		mermaidArrowType = "->>"
 	case Dotted:
 		mermaidArrowType = "-->>"
+	case Cross:
+		mermaidArrowType = "-x"
 	}
 
 	if arrowMaterialization != AsUnmaterialized {
@@ -153,6 +157,17 @@ func (builder *MermaidBuilder) AddNote(participant, note string) {
 	builder.diagramLines = append(builder.diagramLines, fmt.Sprintf("note over %v: %v", participant, note))
 }
 
+func (builder *MermaidBuilder) AddNoteOver(participants []string, note string) {
+	builder.lock.Lock()
+	defer builder.lock.Unlock()
+
+	for _, participant := range participants {
+		builder.participantsUsed[participant] = struct{}{}
+	}
+
+	builder.diagramLines = append(builder.diagramLines, fmt.Sprintf("note over %v: %v", strings.Join(participants, ","), note))
+}
+
 func (builder *MermaidBuilder) EnsureParticipantAdded(name string, participantType ParticipantType, materialization ParticipantMaterialization, dynamism ParticipantDynamism) {
 	builder.lock.Lock()
 	defer builder.lock.Unlock()
@@ -19,8 +19,8 @@ func TestDontShowSnapshotByDefault(t *testing.T) {
 	}
 
 	expectedMermaid := `sequenceDiagram
-    participant x
     actor t1
+    participant x
     note over x: {"Key":"x","Committed":"1","LatestUncommitted":"1","UncommittedByTxId":{}}
     t1 ->> x: set x = 2
     activate x
@@ -44,9 +44,9 @@ func TestShowSnapshotUsedForReading(t *testing.T) {
 	(&table).Data["x"] = NewRow("x", "1")
 
 	events := []Event{
-		NewWrite("t1", TwoPhaseLockingLevel, "x", "2"),
-		NewRead("t1", TwoPhaseLockingLevel, "x"),
-		NewCommit("t1", TwoPhaseLockingLevel),
+		NewWrite("t1", SnapshotIsolationLevel, "x", "2"),
+		NewRead("t1", SnapshotIsolationLevel, "x"),
+		NewCommit("t1", SnapshotIsolationLevel),
 	}
 
 	productedMermaid, err := PlayEvents(events, &table)
@@ -55,22 +55,18 @@ func TestShowSnapshotUsedForReading(t *testing.T) {
 	}
 
 	expectedMermaid := `sequenceDiagram
-    participant x
     actor t1
+    participant x
     note over x: {"Key":"x","Committed":"1","LatestUncommitted":"1","UncommittedByTxId":{}}
     create participant t1 snapshot of x
     t1 ->> t1 snapshot of x: set x = 2
     t1 ->> x: set x = 2
-    activate x
-    activate x
     x ->> t1: ok
     note over x: {"Key":"x","Committed":"1","LatestUncommitted":"2","UncommittedByTxId":{"t1":"2"}}
     t1 ->> t1 snapshot of x: get x
     t1 snapshot of x ->> t1: x = 2
     t1 ->> x: commit
     x ->> t1: ok
-    deactivate x
-    deactivate x
     note over x: {"Key":"x","Committed":"2","LatestUncommitted":"2","UncommittedByTxId":{}}
     destroy t1 snapshot of x
 `
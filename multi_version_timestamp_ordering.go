@@ -0,0 +1,379 @@
+package main
+
+// MultiVersionTimestampOrdering orders transactions by the timestamp they get
+// when they begin, like TimestampOrdering, but keeps a version of a row for
+// every writer. A read picks the committed version with the largest write
+// timestamp below its own and raises that version's read timestamp, so reads
+// never block nor abort. Writes are buffered until commit. A write whose
+// previous version, the one it would be installed after, was already read by
+// a younger transaction arrives too late and aborts the transaction with a
+// TooLateError, both when writing and again when committing.
+//
+// OldestXmin tells how vacuum keeps the versions these transactions may read.
+type MultiVersionTimestampOrdering struct {
+	TransactionId TransactionId
+	Table         *Table
+	Operations    []Operation
+	locks         *TransactionLocks
+	writeSet      map[Key]Value
+	keysTouched   map[Key]struct{}
+	timestamp     int
+	status        TransactionStatus
+	err           error
+}
+
+func NewMultiVersionTimestampOrdering(transactionId TransactionId, table *Table) *MultiVersionTimestampOrdering {
+	t := &MultiVersionTimestampOrdering{
+		TransactionId: transactionId,
+		Table:         table,
+		Operations:    make([]Operation, 0),
+		locks:         NewTransactionLocks(table),
+		writeSet:      make(map[Key]Value),
+		keysTouched:   make(map[Key]struct{}),
+		timestamp:     0,
+		status:        ActiveStatus,
+		err:           nil,
+	}
+
+	t.begin()
+
+	return t
+}
+
+// begin gives the transaction the next timestamp unless it already has one,
+// a transaction starting over after a commit or rollback gets a new one.
+func (t *MultiVersionTimestampOrdering) begin() {
+	if t.timestamp == 0 {
+		t.timestamp = t.Table.nextTimestamp()
+		t.Table.runningTimestamps[t.timestamp] = struct{}{}
+	}
+}
+
+// end gives the timestamp of the finished transaction up, vacuum no longer
+// keeps the versions it could read.
+func (t *MultiVersionTimestampOrdering) end() {
+	delete(t.Table.runningTimestamps, t.timestamp)
+	t.timestamp = 0
+}
+
+func (t *MultiVersionTimestampOrdering) TrySet(key Key, value Value) error {
+	if err := ensureActive(t.TransactionId, t.status); err != nil {
+		return err
+	}
+
+	t.begin()
+
+	if err := t.checkWrite(key); err != nil {
+		return t.fail(err)
+	}
+
+	prevValue, ok := t.writeSet[key]
+	if !ok {
+		prevValue = TombstoneValue()
+		if row, isInTable := t.Table.Data[key]; isInTable {
+			prevValue = row.Versions[row.versionBefore(t.timestamp)].Value
+		}
+	}
+
+	t.Operations = append(t.Operations, Operation{
+		Key:       key,
+		FromValue: prevValue,
+		ToValue:   value,
+	})
+
+	t.keysTouched[key] = struct{}{}
+	t.writeSet[key] = value
+
+	return nil
+}
+
+// checkWrite refuses a write whose previous version a younger transaction
+// already read. When the previous version is a tombstone the write inserts
+// the key, which is refused as well if a younger transaction scanned a range
+// it falls into.
+func (t *MultiVersionTimestampOrdering) checkWrite(key Key) error {
+	conflictType, conflictTs := ScanOperation, t.Table.scanTimestamp(key)
+
+	if row, ok := t.Table.Data[key]; ok {
+		prev := row.Versions[row.versionBefore(t.timestamp)]
+
+		if prev.Value != TombstoneValue() {
+			conflictTs = 0
+		}
+
+		if prev.ReadTs > conflictTs {
+			conflictType, conflictTs = ReadOperation, prev.ReadTs
+		}
+	}
+
+	if conflictTs > t.timestamp {
+		return t.tooLate(key, conflictType, conflictTs)
+	}
+
+	return nil
+}
+
+// TryDelete leaves a tombstone in place of the value, readers that can see
+// it find the key missing.
+func (t *MultiVersionTimestampOrdering) TryDelete(key Key) error {
+	return t.TrySet(key, TombstoneValue())
+}
+
+func (t *MultiVersionTimestampOrdering) TryGet(key Key) (Value, error) {
+	if err := ensureActive(t.TransactionId, t.status); err != nil {
+		return EmptyValue(), err
+	}
+
+	t.begin()
+
+	if value, ok := t.writeSet[key]; ok {
+		return visibleValue(value), nil
+	}
+
+	row, ok := t.Table.Data[key]
+	if !ok {
+		// nobody older may insert the key this transaction found missing
+		t.Table.recordScan(key, key, t.timestamp)
+		return EmptyValue(), nil
+	}
+
+	i := row.versionBefore(t.timestamp)
+	row.Versions[i].ReadTs = max(row.Versions[i].ReadTs, t.timestamp)
+	t.Table.Data[key] = row
+	t.keysTouched[key] = struct{}{}
+
+	return visibleValue(row.Versions[i].Value), nil
+}
+
+// TryScan stamps the range with the timestamp of the transaction, inserting
+// into it is then too late for older transactions.
+func (t *MultiVersionTimestampOrdering) TryScan(from Key, to Key) ([]KeyValue, error) {
+	if err := ensureActive(t.TransactionId, t.status); err != nil {
+		return nil, err
+	}
+
+	t.begin()
+	t.Table.recordScan(from, to, t.timestamp)
+
+	rows, err := scanRows(t.Table, from, to, t.TryGet)
+	if err != nil {
+		return nil, err
+	}
+
+	return withBufferedInserts(t.Table, rows, t.writeSet, from, to), nil
+}
+
+func (t *MultiVersionTimestampOrdering) TryLock(key Key) error {
+	_, err := t.TryLockWith(key, LockMode{Strength: ForUpdate, WaitPolicy: Wait})
+	return err
+}
+
+// TryLockWith takes no lock whatever the mode, so it never waits nor skips a
+// row, it reads the key so that older transactions can no longer write it.
+func (t *MultiVersionTimestampOrdering) TryLockWith(key Key, mode LockMode) (bool, error) {
+	if _, err := t.TryGet(key); err != nil {
+		return false, err
+	}
+
+	_, ok := t.Table.Data[key]
+
+	return ok, nil
+}
+
+// TryLockTable takes no lock either, other transactions are never kept from
+// the table.
+func (t *MultiVersionTimestampOrdering) TryLockTable(lockLevel LockLevel) error {
+	return ensureActive(t.TransactionId, t.status)
+}
+
+func (t *MultiVersionTimestampOrdering) tooLate(key Key, conflictType OperationType, conflictTs int) error {
+	return &TooLateError{
+		TxId:          t.TransactionId,
+		Timestamp:     t.timestamp,
+		OperationType: WriteOperation,
+		Key:           key,
+		ConflictType:  conflictType,
+		ConflictTs:    conflictTs,
+	}
+}
+
+func (t *MultiVersionTimestampOrdering) TryRollback() error {
+	if t.status != ActiveStatus && t.status != AbortedStatus {
+		return ensureActive(t.TransactionId, t.status)
+	}
+
+	t.rollback()
+	t.status = RolledBackStatus
+
+	return nil
+}
+
+// rollback drops the write set, nothing was written to the table. The read
+// timestamps it left on versions stay, they only make older writers abort.
+func (t *MultiVersionTimestampOrdering) rollback() {
+	t.Operations = make([]Operation, 0)
+	t.writeSet = make(map[Key]Value)
+	t.keysTouched = make(map[Key]struct{})
+	t.end()
+}
+
+// fail aborts the transaction after an operation was refused, it stays
+// aborted until rolled back.
+func (t *MultiVersionTimestampOrdering) fail(err error) error {
+	t.rollback()
+	t.status = AbortedStatus
+
+	return err
+}
+
+// TryCommit checks the writes again, a younger transaction may have read
+// their previous versions since, then installs a version for each of them.
+func (t *MultiVersionTimestampOrdering) TryCommit() error {
+	if err := ensureActive(t.TransactionId, t.status); err != nil {
+		return err
+	}
+
+	for _, op := range t.Operations {
+		if err := t.checkWrite(op.Key); err != nil {
+			t.rollback()
+			t.status = RolledBackStatus
+
+			return err
+		}
+	}
+
+	for _, op := range t.Operations {
+		if value, ok := t.writeSet[op.Key]; ok {
+			t.installVersion(op.Key, value)
+			delete(t.writeSet, op.Key)
+		}
+	}
+
+	t.Operations = make([]Operation, 0)
+	t.writeSet = make(map[Key]Value)
+	t.keysTouched = make(map[Key]struct{})
+	t.end()
+	t.status = CommittedStatus
+
+	return nil
+}
+
+// installVersion adds the version written by the transaction to the row. The
+// committed value is the one of the version with the largest write timestamp,
+// which is not necessarily the one committed last.
+func (t *MultiVersionTimestampOrdering) installVersion(key Key, value Value) {
+	row, ok := t.Table.Data[key]
+	if !ok {
+		row = NewRow(key, TombstoneValue())
+	}
+
+	t.Table.clock++
+	row.Versions = append(row.Versions, Version{
+		Value:    value,
+		CommitTs: t.Table.clock,
+		WriteTs:  t.timestamp,
+		ReadTs:   t.timestamp,
+	})
+
+	row.Committed = row.Versions[row.versionBefore(t.Table.timestamps+1)].Value
+	row.LatestUncommitted = row.Committed
+	t.Table.Data[key] = row
+}
+
+// versionTs is the write timestamp of the versions the transaction installs,
+// which orders them rather than the time it commits.
+func (t *MultiVersionTimestampOrdering) versionTs() int {
+	return t.timestamp
+}
+
+func (t *MultiVersionTimestampOrdering) GetKeysTouched() []Key {
+	res := make([]Key, 0)
+
+	for key := range t.keysTouched {
+		res = append(res, key)
+	}
+
+	return res
+}
+
+func (t *MultiVersionTimestampOrdering) GetLocks() *TransactionLocks {
+	return t.locks
+}
+
+func (t *MultiVersionTimestampOrdering) Set(key Key, value Value) Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TrySet(key, value)
+	return t
+}
+
+func (t *MultiVersionTimestampOrdering) Delete(key Key) Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TryDelete(key)
+	return t
+}
+
+func (t *MultiVersionTimestampOrdering) Get(key Key) Value {
+	t.status = reopened(t.status)
+	value, err := t.TryGet(key)
+	t.err = err
+	return value
+}
+
+func (t *MultiVersionTimestampOrdering) Scan(from Key, to Key) []KeyValue {
+	t.status = reopened(t.status)
+	rows, err := t.TryScan(from, to)
+	t.err = err
+	return rows
+}
+
+func (t *MultiVersionTimestampOrdering) Lock(key Key) Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TryLock(key)
+	return t
+}
+
+func (t *MultiVersionTimestampOrdering) LockWith(key Key, mode LockMode) Transaction {
+	t.status = reopened(t.status)
+	_, t.err = t.TryLockWith(key, mode)
+	return t
+}
+
+func (t *MultiVersionTimestampOrdering) LockTable(lockLevel LockLevel) Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TryLockTable(lockLevel)
+	return t
+}
+
+func (t *MultiVersionTimestampOrdering) Rollback() Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TryRollback()
+	return t
+}
+
+func (t *MultiVersionTimestampOrdering) Commit() Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TryCommit()
+	return t
+}
+
+func (t *MultiVersionTimestampOrdering) GetStatus() TransactionStatus {
+	return t.status
+}
+
+func (t *MultiVersionTimestampOrdering) GetError() error {
+	return t.err
+}
+
+// versionBefore returns the index of the version with the largest write
+// timestamp below ts, the latest of them if several share it.
+func (r Row) versionBefore(ts int) int {
+	res := 0
+
+	for i, version := range r.Versions {
+		if version.WriteTs < ts && version.WriteTs >= r.Versions[res].WriteTs {
+			res = i
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestMultiVersionTimestampOrderingReadsOlderVersion(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "50")
+	table.Data["y"] = NewRow("y", "50")
+
+	events := []Event{
+		NewRead("t1", MultiVersionTimestampOrderingLevel, "x"),
+		NewWrite("t2", MultiVersionTimestampOrderingLevel, "x", "40"),
+		NewWrite("t2", MultiVersionTimestampOrderingLevel, "y", "60"),
+		NewCommit("t2", MultiVersionTimestampOrderingLevel),
+		NewRead("t1", MultiVersionTimestampOrderingLevel, "y"),
+		NewCommit("t1", MultiVersionTimestampOrderingLevel),
+	}
+
+	if _, err := PlayEvents(events, &table); err != nil {
+		t.Fatalf("expected PlayEvents to succeed, got error: %v", err)
+	}
+
+	for _, event := range events {
+		if event.Err != nil {
+			t.Errorf("expected %v to succeed, got error: %v", event, event.Err)
+		}
+	}
+
+	if got := events[4].Observed; got != "50" {
+		t.Errorf("got %v, want %v", got, "50")
+	}
+
+	if got := table.Data["y"].Committed; got != "60" {
+		t.Errorf("got %v, want %v", got, "60")
+	}
+}
+
+func TestMultiVersionTimestampOrderingAbortsWriteAfterYoungerRead(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "A")
+
+	older := NewMultiVersionTimestampOrdering("1", &table)
+	olderInserting := NewMultiVersionTimestampOrdering("2", &table)
+	younger := NewMultiVersionTimestampOrdering("3", &table)
+	younger.Get("x")
+	younger.Scan("a", "z")
+
+	want := "1 with timestamp 1 is too late to write x, read at timestamp 3"
+	if err := older.TrySet("x", "B"); err == nil || err.Error() != want {
+		t.Errorf("got %v, want %v", err, want)
+	}
+
+	want = "2 with timestamp 2 is too late to insert y, scanned at timestamp 3"
+	if err := olderInserting.TrySet("y", "B"); err == nil || err.Error() != want {
+		t.Errorf("got %v, want %v", err, want)
+	}
+
+	if status := older.GetStatus(); status != AbortedStatus {
+		t.Errorf("got %v, want %v", status, AbortedStatus)
+	}
+}
+
+func TestMultiVersionTimestampOrderingValidatesWritesAtCommit(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "A")
+
+	older := NewMultiVersionTimestampOrdering("1", &table)
+	older.Set("x", "B")
+
+	younger := NewMultiVersionTimestampOrdering("2", &table)
+	if value := younger.Get("x"); value != "A" {
+		t.Errorf("got %v, want %v", value, "A")
+	}
+
+	var tooLateErr *TooLateError
+	if err := older.TryCommit(); !errors.As(err, &tooLateErr) {
+		t.Fatalf("got %v, want too late error", err)
+	}
+
+	if status := older.GetStatus(); status != RolledBackStatus {
+		t.Errorf("got %v, want %v", status, RolledBackStatus)
+	}
+
+	if got := table.Data["x"].Committed; got != "A" {
+		t.Errorf("got %v, want %v", got, "A")
+	}
+}
+
+func TestMultiVersionTimestampOrderingOrdersVersionsByTimestamp(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "0")
+
+	older := NewMultiVersionTimestampOrdering("1", &table)
+	younger := NewMultiVersionTimestampOrdering("2", &table)
+
+	younger.Set("x", "2").Commit()
+	older.Set("x", "1").Commit()
+
+	if err := older.GetError(); err != nil {
+		t.Fatalf("expected the older write to commit, got error: %v", err)
+	}
+
+	if got := table.Data["x"].Committed; got != "2" {
+		t.Errorf("got %v, want %v", got, "2")
+	}
+
+	if got := NewMultiVersionTimestampOrdering("3", &table).Get("x"); got != "2" {
+		t.Errorf("got %v, want %v", got, "2")
+	}
+}
+
+func TestMultiVersionTimestampOrderingHistoryFollowsVersionOrder(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "0")
+	table.Data["y"] = NewRow("y", "0")
+	table.History = NewHistory()
+
+	events := []Event{
+		NewRead("t1", MultiVersionTimestampOrderingLevel, "y"),
+		NewWrite("t2", MultiVersionTimestampOrderingLevel, "x", "2"),
+		NewWrite("t2", MultiVersionTimestampOrderingLevel, "y", "2"),
+		NewCommit("t2", MultiVersionTimestampOrderingLevel),
+		NewWrite("t1", MultiVersionTimestampOrderingLevel, "x", "1"),
+		NewCommit("t1", MultiVersionTimestampOrderingLevel),
+	}
+
+	if _, err := PlayEvents(events, &table); err != nil {
+		t.Fatalf("expected PlayEvents to succeed, got error: %v", err)
+	}
+
+	if anomalies := table.History.Classify(); len(anomalies) != 0 {
+		t.Errorf("got %v, want no anomaly", anomalies)
+	}
+
+	order, err := table.History.CheckConflictSerializable()
+	if err != nil {
+		t.Fatalf("got %v, want the history to be conflict serializable", err)
+	}
+
+	want := []TransactionId{"t1", "t2"}
+	if !slices.Equal(order, want) {
+		t.Errorf("got %v, want %v", order, want)
+	}
+}
+
+func TestMultiVersionTimestampOrderingPreventsWriteSkewSnapshotIsolationAllows(t *testing.T) {
+	var writeSkew Scenario
+	for _, scenario := range Catalog() {
+		if scenario.Name == "write skew" {
+			writeSkew = scenario
+		}
+	}
+
+	tests := []struct {
+		level TransactionLevel
+		want  Verdict
+	}{
+		{level: SnapshotIsolationLevel, want: Allowed},
+		{level: MultiVersionTimestampOrderingLevel, want: Prevented},
+	}
+
+	for _, tt := range tests {
+		got, err := writeSkew.Run(tt.level)
+		if err != nil {
+			t.Fatalf("expected %v to run, got error: %v", tt.level, err)
+		}
+
+		if got != tt.want {
+			t.Errorf("%v: got %v, want %v", tt.level, got, tt.want)
+		}
+	}
+}
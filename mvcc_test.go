@@ -0,0 +1,79 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCommitsAppendVersions(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "A")
+
+	NewSnapshotIsolation("1", &table).Set("x", "B").Commit()
+	NewSnapshotIsolation("2", &table).Delete("x").Commit()
+
+	want := []Version{
+		{Value: "A", CommitTs: 0},
+		{Value: "B", CommitTs: 1},
+		{Value: TombstoneValue(), CommitTs: 2},
+	}
+
+	if got := table.Data["x"].Versions; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSnapshotReadsVersionVisibleAtStart(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "A")
+
+	t1 := NewSnapshotIsolation("1", &table)
+	t1.Get("x")
+
+	NewSnapshotIsolation("2", &table).Set("x", "B").Commit()
+
+	t3 := NewSnapshotIsolation("3", &table)
+	t3.Get("x")
+
+	NewSnapshotIsolation("4", &table).Set("x", "C").Set("y", "C").Commit()
+
+	if value := t1.Get("x"); value != "A" {
+		t.Errorf("got %v, want %v", value, "A")
+	}
+
+	if value := t3.Get("x"); value != "B" {
+		t.Errorf("got %v, want %v", value, "B")
+	}
+
+	if value := t3.Get("y"); value != EmptyValue() {
+		t.Errorf("got %v, want %v", value, EmptyValue())
+	}
+
+	if value := NewSnapshotIsolation("5", &table).Get("x"); value != "C" {
+		t.Errorf("got %v, want %v", value, "C")
+	}
+}
+
+func TestGetSnapshot(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "A")
+
+	if _, ok := table.GetSnapshot("1"); ok {
+		t.Errorf("expected no snapshot before the transaction started")
+	}
+
+	t1 := NewSnapshotIsolation("1", &table)
+	t1.Get("x")
+
+	NewSnapshotIsolation("2", &table).Set("x", "B").Set("y", "B").Commit()
+
+	snapshot, ok := table.GetSnapshot("1")
+	if !ok {
+		t.Fatalf("expected a snapshot once the transaction started")
+	}
+
+	want := Snapshot{"x": "A", "y": TombstoneValue()}
+	if !reflect.DeepEqual(snapshot, want) {
+		t.Errorf("got %v, want %v", snapshot, want)
+	}
+}
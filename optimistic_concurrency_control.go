@@ -0,0 +1,290 @@
+package main
+
+// OptimisticConcurrencyControl takes no locks. Reads see the latest committed
+// values and are remembered in a read set, writes are buffered in a write set
+// until commit. Committing validates backwards: if a transaction committed a
+// key of the read set, or a key in a scanned range, since this one started,
+// it is aborted instead.
+type OptimisticConcurrencyControl struct {
+	TransactionId TransactionId
+	Table         *Table
+	Operations    []Operation
+	locks         *TransactionLocks
+	readSet       map[Key]struct{}
+	readRanges    []keyRange
+	writeSet      map[Key]Value
+	keysTouched   map[Key]struct{}
+	status        TransactionStatus
+	err           error
+}
+
+func NewOptimisticConcurrencyControl(transactionId TransactionId, table *Table) *OptimisticConcurrencyControl {
+	table.EnsureSnapshotTaken(transactionId)
+
+	return &OptimisticConcurrencyControl{
+		TransactionId: transactionId,
+		Table:         table,
+		Operations:    make([]Operation, 0),
+		locks:         NewTransactionLocks(table),
+		readSet:       make(map[Key]struct{}),
+		readRanges:    make([]keyRange, 0),
+		writeSet:      make(map[Key]Value),
+		keysTouched:   make(map[Key]struct{}),
+		status:        ActiveStatus,
+		err:           nil,
+	}
+}
+
+func (t *OptimisticConcurrencyControl) TrySet(key Key, value Value) error {
+	if err := ensureActive(t.TransactionId, t.status); err != nil {
+		return err
+	}
+
+	t.Table.EnsureSnapshotTaken(t.TransactionId)
+
+	prevValue, ok := t.writeSet[key]
+	if !ok {
+		prevValue = TombstoneValue()
+		if row, isInTable := t.Table.Data[key]; isInTable {
+			prevValue = row.Committed
+		}
+	}
+
+	t.Operations = append(t.Operations, Operation{
+		Key:       key,
+		FromValue: prevValue,
+		ToValue:   value,
+	})
+
+	t.keysTouched[key] = struct{}{}
+	t.writeSet[key] = value
+
+	return nil
+}
+
+// TryDelete leaves a tombstone in place of the value, readers that can see
+// it find the key missing.
+func (t *OptimisticConcurrencyControl) TryDelete(key Key) error {
+	return t.TrySet(key, TombstoneValue())
+}
+
+func (t *OptimisticConcurrencyControl) TryGet(key Key) (Value, error) {
+	if err := ensureActive(t.TransactionId, t.status); err != nil {
+		return EmptyValue(), err
+	}
+
+	t.Table.EnsureSnapshotTaken(t.TransactionId)
+
+	if value, ok := t.writeSet[key]; ok {
+		return visibleValue(value), nil
+	}
+
+	t.readSet[key] = struct{}{}
+
+	row, ok := t.Table.Data[key]
+	if !ok {
+		return EmptyValue(), nil
+	}
+
+	t.keysTouched[key] = struct{}{}
+
+	return visibleValue(row.Committed), nil
+}
+
+// TryScan sees the rows of the range as last committed along with its own
+// writes, validating the range catches the rows inserted into it meanwhile.
+func (t *OptimisticConcurrencyControl) TryScan(from Key, to Key) ([]KeyValue, error) {
+	if err := ensureActive(t.TransactionId, t.status); err != nil {
+		return nil, err
+	}
+
+	t.Table.EnsureSnapshotTaken(t.TransactionId)
+	t.readRanges = append(t.readRanges, keyRange{from: from, to: to})
+
+	rows, err := scanRows(t.Table, from, to, t.TryGet)
+	if err != nil {
+		return nil, err
+	}
+
+	return withBufferedInserts(t.Table, rows, t.writeSet, from, to), nil
+}
+
+func (t *OptimisticConcurrencyControl) TryLock(key Key) error {
+	_, err := t.TryLockWith(key, LockMode{Strength: ForUpdate, WaitPolicy: Wait})
+	return err
+}
+
+// TryLockWith takes no lock whatever the mode, so it never waits nor skips a
+// row, it only makes commit validate the key as if it was read.
+func (t *OptimisticConcurrencyControl) TryLockWith(key Key, mode LockMode) (bool, error) {
+	if err := ensureActive(t.TransactionId, t.status); err != nil {
+		return false, err
+	}
+
+	t.Table.EnsureSnapshotTaken(t.TransactionId)
+	t.readSet[key] = struct{}{}
+
+	_, ok := t.Table.Data[key]
+
+	return ok, nil
+}
+
+// TryLockTable takes no lock either, other transactions are never kept from
+// the table.
+func (t *OptimisticConcurrencyControl) TryLockTable(lockLevel LockLevel) error {
+	return ensureActive(t.TransactionId, t.status)
+}
+
+func (t *OptimisticConcurrencyControl) TryRollback() error {
+	if t.status != ActiveStatus && t.status != AbortedStatus {
+		return ensureActive(t.TransactionId, t.status)
+	}
+
+	t.rollback()
+	t.status = RolledBackStatus
+
+	return nil
+}
+
+// rollback drops the read and write sets, nothing was written to the table.
+func (t *OptimisticConcurrencyControl) rollback() {
+	t.Table.DeleteSnapshot(t.TransactionId)
+	t.Operations = make([]Operation, 0)
+	t.readSet = make(map[Key]struct{})
+	t.readRanges = make([]keyRange, 0)
+	t.writeSet = make(map[Key]Value)
+	t.keysTouched = make(map[Key]struct{})
+}
+
+func (t *OptimisticConcurrencyControl) TryCommit() error {
+	if err := ensureActive(t.TransactionId, t.status); err != nil {
+		return err
+	}
+
+	if !t.isValid() {
+		return t.abort(ErrValidationFailure)
+	}
+
+	for _, op := range t.Operations {
+		if _, ok := t.Table.Data[op.Key]; !ok {
+			t.Table.Data[op.Key] = NewRow(op.Key, TombstoneValue())
+		}
+
+		t.Table.SetCommitted(op.Key, op.ToValue, t.TransactionId)
+	}
+
+	t.Table.DeleteSnapshot(t.TransactionId)
+	t.Operations = make([]Operation, 0)
+	t.readSet = make(map[Key]struct{})
+	t.readRanges = make([]keyRange, 0)
+	t.writeSet = make(map[Key]Value)
+	t.keysTouched = make(map[Key]struct{})
+	t.status = CommittedStatus
+
+	return nil
+}
+
+// isValid tells whether none of the keys read, nor any key in a scanned
+// range, was committed since the transaction started.
+func (t *OptimisticConcurrencyControl) isValid() bool {
+	for key := range t.readSet {
+		if t.Table.IsCommittedSinceSnapshot(key, t.TransactionId) {
+			return false
+		}
+	}
+
+	for _, keyRange := range t.readRanges {
+		for _, key := range t.Table.KeysBetween(keyRange.from, keyRange.to) {
+			if t.Table.IsCommittedSinceSnapshot(key, t.TransactionId) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func (t *OptimisticConcurrencyControl) abort(cause error) error {
+	t.rollback()
+	t.status = RolledBackStatus
+
+	return &SerializationFailureError{TxId: t.TransactionId, Cause: cause}
+}
+
+func (t *OptimisticConcurrencyControl) GetKeysTouched() []Key {
+	res := make([]Key, 0)
+
+	for key := range t.keysTouched {
+		res = append(res, key)
+	}
+
+	return res
+}
+
+func (t *OptimisticConcurrencyControl) GetLocks() *TransactionLocks {
+	return t.locks
+}
+
+func (t *OptimisticConcurrencyControl) Set(key Key, value Value) Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TrySet(key, value)
+	return t
+}
+
+func (t *OptimisticConcurrencyControl) Delete(key Key) Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TryDelete(key)
+	return t
+}
+
+func (t *OptimisticConcurrencyControl) Get(key Key) Value {
+	t.status = reopened(t.status)
+	value, err := t.TryGet(key)
+	t.err = err
+	return value
+}
+
+func (t *OptimisticConcurrencyControl) Scan(from Key, to Key) []KeyValue {
+	t.status = reopened(t.status)
+	rows, err := t.TryScan(from, to)
+	t.err = err
+	return rows
+}
+
+func (t *OptimisticConcurrencyControl) Lock(key Key) Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TryLock(key)
+	return t
+}
+
+func (t *OptimisticConcurrencyControl) LockWith(key Key, mode LockMode) Transaction {
+	t.status = reopened(t.status)
+	_, t.err = t.TryLockWith(key, mode)
+	return t
+}
+
+func (t *OptimisticConcurrencyControl) LockTable(lockLevel LockLevel) Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TryLockTable(lockLevel)
+	return t
+}
+
+func (t *OptimisticConcurrencyControl) Rollback() Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TryRollback()
+	return t
+}
+
+func (t *OptimisticConcurrencyControl) Commit() Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TryCommit()
+	return t
+}
+
+func (t *OptimisticConcurrencyControl) GetStatus() TransactionStatus {
+	return t.status
+}
+
+func (t *OptimisticConcurrencyControl) GetError() error {
+	return t.err
+}
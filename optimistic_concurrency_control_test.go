@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestOptimisticWritesAreInvisibleUntilCommit(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "A")
+
+	t1 := NewOptimisticConcurrencyControl("1", &table)
+	t2 := NewOptimisticConcurrencyControl("2", &table)
+
+	t1.Set("x", "B").Set("y", "B")
+
+	if value := t1.Get("x"); value != "B" {
+		t.Errorf("got %v, want %v", value, "B")
+	}
+
+	if value := t2.Get("x"); value != "A" {
+		t.Errorf("got %v, want %v", value, "A")
+	}
+
+	if _, ok := table.Data["y"]; ok {
+		t.Errorf("expected y not to be inserted before commit")
+	}
+
+	t1.Commit()
+
+	if value := t2.Get("y"); value != "B" {
+		t.Errorf("got %v, want %v", value, "B")
+	}
+}
+
+func TestOptimisticValidationAbortsAtCommit(t *testing.T) {
+	writeSkew := func(level TransactionLevel) []Event {
+		return []Event{
+			NewRead("doctor-a", level, "doctor-b-is-on-call"),
+			NewRead("doctor-b", level, "doctor-a-is-on-call"),
+			NewWrite("doctor-a", level, "doctor-a-is-on-call", "false"),
+			NewWrite("doctor-b", level, "doctor-b-is-on-call", "false"),
+			NewCommit("doctor-a", level),
+			NewCommit("doctor-b", level),
+		}
+	}
+
+	isDeadlock := func(err error) bool {
+		var deadlockErr *DeadlockError
+		return errors.As(err, &deadlockErr)
+	}
+	isValidationFailure := func(err error) bool { return errors.Is(err, ErrValidationFailure) }
+
+	tests := []struct {
+		level      TransactionLevel
+		failingAt  int
+		isExpected func(err error) bool
+	}{
+		{level: TwoPhaseLockingLevel, failingAt: 3, isExpected: isDeadlock},
+		{level: OptimisticConcurrencyControlLevel, failingAt: 5, isExpected: isValidationFailure},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.level.String(), func(t *testing.T) {
+			table := NewTable()
+			table.Data["doctor-a-is-on-call"] = NewRow("doctor-a-is-on-call", "true")
+			table.Data["doctor-b-is-on-call"] = NewRow("doctor-b-is-on-call", "true")
+
+			events := writeSkew(tt.level)
+			if _, err := PlayEvents(events, &table); err != nil {
+				t.Fatalf("expected PlayEvents to succeed, got error: %v", err)
+			}
+
+			for i, event := range events[:tt.failingAt] {
+				if event.Err != nil {
+					t.Errorf("event %d: expected no error, got %v", i, event.Err)
+				}
+			}
+
+			if err := events[tt.failingAt].Err; !tt.isExpected(err) {
+				t.Errorf("event %d: got unexpected error %v", tt.failingAt, err)
+			}
+
+			if got := table.Data["doctor-b-is-on-call"].Committed; got != "true" {
+				t.Errorf("got %v, want %v", got, "true")
+			}
+		})
+	}
+}
+
+func TestOptimisticValidationCatchesPhantoms(t *testing.T) {
+	table := NewTable()
+	table.Data["employee-1"] = NewRow("employee-1", "sales")
+
+	t1 := NewOptimisticConcurrencyControl("1", &table)
+	t1.Scan("employee-0", "employee-9")
+
+	NewOptimisticConcurrencyControl("2", &table).Set("employee-2", "sales").Commit()
+
+	if err := t1.TryCommit(); !errors.Is(err, ErrValidationFailure) {
+		t.Errorf("got %v, want %v", err, ErrValidationFailure)
+	}
+
+	if status := t1.GetStatus(); status != RolledBackStatus {
+		t.Errorf("got %v, want %v", status, RolledBackStatus)
+	}
+}
@@ -2,53 +2,56 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"sync"
-	"time"
+	"slices"
 )
 
-const TIMEOUT_SECS = 3
-const STAGGER_DELAY_MILLIS = 10
-
 func PlayEvents(events []Event, table *Table) (string, error) {
 	if len(events) == 0 {
 		return "", nil
 	}
 
-	transactionEvents := make(map[TransactionId][]Event)
 	transactionOrder := make([]TransactionId, 0)
-	rows := make(map[Key]struct{})
+	transactionSeen := make(map[TransactionId]struct{})
+	rowOrder := make([]Key, 0)
+	rowSeen := make(map[Key]struct{})
 
 	for i, event := range events {
-		transaction := event.TxId
+		event.Position = i
 
-		if _, ok := transactionEvents[transaction]; !ok {
-			transactionOrder = append(transactionOrder, transaction)
+		if _, ok := transactionSeen[event.TxId]; !ok {
+			transactionSeen[event.TxId] = struct{}{}
+			transactionOrder = append(transactionOrder, event.TxId)
 		}
 
-		transactionEvents[transaction] = append(transactionEvents[transaction], event)
-		event.Position = i
+		keys := []Key{event.Key}
+		if event.OperationType == ScanOperation {
+			keys = table.KeysBetween(event.Key, event.End)
+		}
 
-		rows[event.Key] = struct{}{}
+		for _, key := range keys {
+			if _, ok := rowSeen[key]; !ok && key != EmptyKey() {
+				rowSeen[key] = struct{}{}
+				rowOrder = append(rowOrder, key)
+			}
+		}
 	}
 
 	mermaid := NewMermaidBuilder()
 
-	for row := range rows {
-		if row == EmptyKey() {
-			continue
-		}
-
-		mermaid.EnsureParticipantAdded(string(row), RowParticipant, Materialized, Static)
+	for _, key := range rowOrder {
+		mermaid.EnsureParticipantAdded(string(key), RowParticipant, Materialized, Static)
 	}
 
 	for _, transactionId := range transactionOrder {
 		mermaid.EnsureParticipantAdded(string(transactionId), TransactionParticipant, Materialized, Static)
+		table.LockManager.RegisterTransaction(transactionId)
 	}
 
-	for key := range rows {
+	for _, key := range rowOrder {
 		row, ok := table.Data[key]
-		if !ok || key == EmptyKey() {
+		if !ok {
 			continue
 		}
 		rowJson, err := json.Marshal(row)
@@ -57,163 +60,354 @@ func PlayEvents(events []Event, table *Table) (string, error) {
 		}
 	}
 
-	var transactions sync.Map
+	scheduler := NewScheduler(table.LockManager)
+	table.LockManager.SetObserver(scheduler)
+	defer table.LockManager.SetObserver(nil)
+
+	transactions := make(map[TransactionId]Transaction)
+
+	for _, event := range events {
+		run := func() {
+			tx, ok := transactions[event.TxId]
+			if !ok {
+				var err error
+				tx, err = TransactionFromTransactionLevel(event.TxLevel, event.TxId, table)
+				if err != nil {
+					event.Err = err
+					return
+				}
+
+				transactions[event.TxId] = tx
+			}
+
+			playEvent(mermaid, table, tx, event)
+			event.Status = tx.GetStatus()
+
+			var deadlockErr *DeadlockError
+			if errors.As(event.Err, &deadlockErr) {
+				addNoteOverTransactions(mermaid, transactionOrder, deadlockErr.Cycle[1:], event.Err.Error())
+			}
+		}
+
+		onBlocked := func() {
+			isRowOperation := !isOverTransaction(event)
+			if isRowOperation {
+				mermaid.AddArrow(Dotted, string(event.TxId), string(event.Key), describeOperation(event), AsMaterialized)
+			} else {
+				mermaid.AddNote(string(event.TxId), "waiting to "+describeOperation(event))
+			}
+
+			if table.LockManager.IsWaitingOn(event.TxId, table.lock) {
+				mermaid.AddNote(string(event.TxId), "table lock "+table.TableLockQueue().String())
+				return
+			}
+
+			if queue, ok := table.LockQueue(event.Key); ok && isRowOperation {
+				mermaid.AddNote(string(event.Key), queue.String())
+			}
+		}
 
-	var wg sync.WaitGroup
-	unblocks := make(map[TransactionId]chan struct{})
-	for txId := range transactionEvents {
-		unblocks[txId] = make(chan struct{})
+		scheduler.Schedule(event.TxId, run, onBlocked)
 	}
 
-	for txId, events := range transactionEvents {
-		wg.Add(1)
-		go func() error {
-			defer wg.Done()
+	if err := scheduler.Wait(); err != nil {
+		return mermaid.Build(), err
+	}
 
-			<-unblocks[txId]
-			for _, event := range events {
-				txVal, ok := transactions.Load(event.TxId)
-				tx, _ := txVal.(Transaction)
+	if table.History != nil {
+		for _, anomaly := range table.History.Classify() {
+			addAnomaly(mermaid, transactionOrder, anomaly)
+		}
+	}
 
-				if !ok {
-					tx, err := TransactionFromTransactionLevel(event.TxLevel, event.TxId, table)
-					if err != nil {
-						return nil
-					}
+	return mermaid.Build(), nil
+}
 
-					transactions.Store(event.TxId, tx)
-				}
-				isUsingSnapshots := event.TxLevel >= SnapshotIsolationLevel
+// addAnomaly notes the anomaly over the transactions taking part in it.
+func addAnomaly(mermaid *MermaidBuilder, transactionOrder []TransactionId, anomaly Anomaly) {
+	addNoteOverTransactions(mermaid, transactionOrder, anomaly.Transactions(), anomaly.String())
+}
+
+// addNoteOverTransactions notes over the involved transactions, mermaid notes
+// span at most two participants so it spans from the first of them to the
+// last in the order of the diagram.
+func addNoteOverTransactions(mermaid *MermaidBuilder, transactionOrder []TransactionId, involved []TransactionId, note string) {
+	participants := make([]string, 0)
+
+	for _, txId := range transactionOrder {
+		if slices.Contains(involved, txId) {
+			participants = append(participants, string(txId))
+		}
+	}
+
+	if len(participants) > 2 {
+		participants = []string{participants[0], participants[len(participants)-1]}
+	}
+
+	mermaid.AddNoteOver(participants, note)
+}
+
+func playEvent(mermaid *MermaidBuilder, table *Table, tx Transaction, event Event) {
+	isUsingSnapshots := isReadingSnapshots(event.TxLevel)
+
+	switch event.OperationType {
+	case WriteOperation, DeleteOperation:
+		if event.Key == EmptyKey() {
+			return
+		}
+
+		var err error
+		if event.OperationType == DeleteOperation {
+			err = tx.TryDelete(event.Key)
+		} else {
+			err = tx.TrySet(event.Key, event.To)
+		}
+
+		if err != nil {
+			event.Err = err
+			mermaid.AddArrow(Solid, string(event.TxId), string(event.Key), describeOperation(event), AsMaterialized)
+			addRefusal(mermaid, event, err)
+			return
+		}
 
-				switch event.OperationType {
-				case WriteOperation:
-					if event.Key == EmptyKey() {
-						continue
-					}
+		if isUsingSnapshots {
+			snapshotName := toSnapshotName(event.TxId, event.Key)
+			mermaid.EnsureParticipantAdded(snapshotName, SnapshotParticipant, Unmaterialized, Dynamic)
+			mermaid.AddArrow(Solid, string(event.TxId), snapshotName, describeOperation(event), AsUnmaterialized)
+		}
 
-					row, found := table.Data[event.Key]
+		mermaid.AddArrow(Solid, string(event.TxId), string(event.Key), describeOperation(event), AsMaterialized)
+		mermaid.EnsureParticipantAdded(string(event.Key), RowParticipant, Materialized, Static)
 
-					if found && row.Lock.IsBlocked(event.TxId) {
-						mermaid.AddArrow(Dotted, string(event.TxId), string(event.Key), fmt.Sprintf("set %v = %v", event.Key, event.To), AsMaterialized)
-					}
+		mermaid.EnsureActivatedOnLevel(activationLevel(tx, event.Key), string(event.Key))
+		mermaid.AddArrow(Solid, string(event.Key), string(event.TxId), "ok", AsMaterialized)
 
-					tx.Set(event.Key, event.To)
+		row, ok := table.Data[event.Key]
+		rowJson, err := json.Marshal(row)
+		if ok && err == nil {
+			mermaid.AddNote(string(event.Key), string(rowJson))
+		}
 
-					if isUsingSnapshots {
-						snapshotName := toSnapshotName(event.TxId, event.Key)
-						mermaid.EnsureParticipantAdded(snapshotName, SnapshotParticipant, Unmaterialized, Dynamic)
-						mermaid.AddArrow(Solid, string(event.TxId), snapshotName, fmt.Sprintf("set %v = %v", event.Key, event.To), AsUnmaterialized)
-					}
+	case ReadOperation:
+		if event.Key == EmptyKey() {
+			return
+		}
 
-					mermaid.AddArrow(Solid, string(event.TxId), string(event.Key), fmt.Sprintf("set %v = %v", event.Key, event.To), AsMaterialized)
-					mermaid.EnsureParticipantAdded(string(event.Key), RowParticipant, Materialized, Static)
+		value, err := tx.TryGet(event.Key)
+		event.Observed = value
+		if err != nil {
+			event.Err = err
+			mermaid.AddArrow(Solid, string(event.TxId), string(event.Key), "get "+string(event.Key), AsMaterialized)
+			addRefusal(mermaid, event, err)
+			return
+		}
 
-					lockLevels := tx.GetLocks().GetLockLevels()
-					lockLevel := lockLevels[event.Key]
+		addRead(mermaid, table, tx, event, event.Key, value)
 
-					activationLevel := 0
-					if lockLevel >= Read {
-						activationLevel += 1
-					}
+	case ScanOperation:
+		rows, err := tx.TryScan(event.Key, event.End)
+		event.Observed = Value(fmt.Sprint(rows))
+		if err != nil {
+			event.Err = err
+			addRefusal(mermaid, event, err)
+			return
+		}
 
-					if lockLevel == ReadWrite {
-						activationLevel += 1
-					}
+		if len(rows) == 0 {
+			mermaid.AddNote(string(event.TxId), describeOperation(event)+" found no rows")
+		}
 
-					mermaid.EnsureActivatedOnLevel(activationLevel, string(event.Key))
-					mermaid.AddArrow(Solid, string(event.Key), string(event.TxId), "ok", AsMaterialized)
+		for _, row := range rows {
+			addRead(mermaid, table, tx, event, row.Key, row.Value)
+		}
 
-					row, ok := table.Data[event.Key]
-					rowJson, err := json.Marshal(row)
-					if ok && err == nil {
-						mermaid.AddNote(string(event.Key), string(rowJson))
-					}
+	case LockOperation:
+		isLocked, err := tx.TryLockWith(event.Key, event.LockMode)
+		mermaid.AddArrow(Solid, string(event.TxId), string(event.Key), describeOperation(event), AsMaterialized)
+		if err != nil {
+			event.Err = err
+			addRefusal(mermaid, event, err)
+			return
+		}
 
-				case ReadOperation:
-					if event.Key == EmptyKey() {
-						continue
-					}
+		if _, ok := table.Data[event.Key]; !ok {
+			mermaid.AddArrow(Solid, string(event.Key), string(event.TxId), "no row", AsMaterialized)
+			return
+		}
 
-					row, found := table.Data[event.Key]
+		if !isLocked {
+			mermaid.AddArrow(Solid, string(event.Key), string(event.TxId), "skipped", AsMaterialized)
+			return
+		}
 
-					if found && row.Lock.IsBlocked(event.TxId) {
-						mermaid.AddArrow(Dotted, string(event.TxId), string(event.Key), ": get "+string(event.Key), AsMaterialized)
-					}
+		mermaid.EnsureActivatedOnLevel(activationLevel(tx, event.Key), string(event.Key))
+		mermaid.AddArrow(Solid, string(event.Key), string(event.TxId), "ok", AsMaterialized)
 
-					value := tx.Get(event.Key)
+	case LockTableOperation:
+		if err := tx.TryLockTable(event.LockLevel); err != nil {
+			event.Err = err
+			addRefusal(mermaid, event, err)
+			return
+		}
 
-					readTarget := string(event.Key)
+		mermaid.AddNote(string(event.TxId), describeOperation(event))
 
-					_, hasSnapshots := table.GetSnapshot(txId)
+	case Commit:
+		keysTouched := tx.GetKeysTouched()
+		slices.Sort(keysTouched)
+		commitErr := tx.TryCommit()
+		event.Err = commitErr
+		for _, key := range keysTouched {
+			mermaid.AddArrow(Solid, string(event.TxId), string(key), "commit", AsMaterialized)
+		}
 
-					if isUsingSnapshots && hasSnapshots {
-						readTarget = toSnapshotName(event.TxId, event.Key)
-						mermaid.EnsureParticipantAdded(readTarget, SnapshotParticipant, Materialized, Dynamic)
-					}
+		// a transaction depending on an uncommitted write stays active, it
+		// keeps its locks and may commit once the writer did
+		var dependencyErr *UncommittedDependencyError
+		isDeferred := errors.As(commitErr, &dependencyErr)
+
+		for _, key := range keysTouched {
+			switch {
+			case isDeferred:
+				mermaid.AddArrow(Solid, string(key), string(event.TxId), "commit deferred", AsMaterialized)
+			case commitErr != nil:
+				mermaid.AddArrow(Cross, string(key), string(event.TxId), "abort", AsMaterialized)
+			default:
+				mermaid.AddArrow(Solid, string(key), string(event.TxId), "ok", AsMaterialized)
+			}
 
-					mermaid.AddArrow(Solid, string(event.TxId), readTarget, "get "+string(event.Key), MaterializeOpposite)
+			if !isDeferred {
+				mermaid.EnsureActivatedOnLevel(0, string(key))
+			}
 
-					lockLevels := tx.GetLocks().GetLockLevels()
-					lockLevel := lockLevels[event.Key]
+			row, ok := table.Data[key]
+			rowJson, err := json.Marshal(row)
+			if ok && err == nil {
+				mermaid.AddNote(string(key), string(rowJson))
+			}
+		}
 
-					if lockLevel < Read {
-						mermaid.EnsureActivatedOnLevel(1, string(event.Key))
-					}
+		if commitErr != nil {
+			mermaid.AddNote(string(event.TxId), commitErr.Error())
+		}
 
-					mermaid.AddArrow(Solid, readTarget, string(event.TxId), fmt.Sprintf("%v = %v", event.Key, value), AsMaterialized)
+		if isUsingSnapshots && !isDeferred {
+			for _, key := range keysTouched {
+				snapshotName := toSnapshotName(event.TxId, key)
+				mermaid.EnsureParticipantDestroyed(snapshotName)
+			}
+		}
 
-				case Commit:
-					if event.Key == EmptyKey() {
-						continue
-					}
+	case Rollback:
+		keysTouched := tx.GetKeysTouched()
+		slices.Sort(keysTouched)
+		event.Err = tx.TryRollback()
 
-					keysTouched := tx.GetKeysTouched()
-					tx.Commit()
-					for _, key := range keysTouched {
-						mermaid.AddArrow(Solid, string(event.TxId), string(key), "commit", AsMaterialized)
-					}
+		for _, key := range keysTouched {
+			mermaid.AddArrow(Solid, string(event.TxId), string(key), "rollback", AsMaterialized)
+		}
 
-					for _, key := range keysTouched {
-						mermaid.AddArrow(Solid, string(key), string(event.TxId), "ok", AsMaterialized)
-						mermaid.EnsureActivatedOnLevel(0, string(key))
+		for _, key := range keysTouched {
+			mermaid.AddArrow(Solid, string(key), string(event.TxId), "ok", AsMaterialized)
+			mermaid.EnsureActivatedOnLevel(0, string(key))
 
-						row, ok := table.Data[key]
-						rowJson, err := json.Marshal(row)
-						if ok && err == nil {
-							mermaid.AddNote(string(key), string(rowJson))
-						}
-					}
+			row, ok := table.Data[key]
+			rowJson, err := json.Marshal(row)
+			if ok && err == nil {
+				mermaid.AddNote(string(key), string(rowJson))
+			}
+		}
 
-					if isUsingSnapshots {
-						for _, key := range keysTouched {
-							snapshotName := toSnapshotName(event.TxId, key)
-							mermaid.EnsureParticipantDestroyed(snapshotName)
-						}
-					}
-				}
+		if event.Err != nil {
+			mermaid.AddNote(string(event.TxId), event.Err.Error())
+		}
 
+		if isUsingSnapshots {
+			for _, key := range keysTouched {
+				snapshotName := toSnapshotName(event.TxId, key)
+				mermaid.EnsureParticipantDestroyed(snapshotName)
 			}
-			return nil
-		}()
+		}
+	}
+}
+
+// addRead draws the read of key by a get or a scan, from the snapshot of the
+// transaction if it reads one.
+func addRead(mermaid *MermaidBuilder, table *Table, tx Transaction, event Event, key Key, value Value) {
+	readTarget := string(key)
 
+	_, hasSnapshots := table.GetSnapshot(event.TxId)
+
+	if isReadingSnapshots(event.TxLevel) && hasSnapshots {
+		readTarget = toSnapshotName(event.TxId, key)
+		mermaid.EnsureParticipantAdded(readTarget, SnapshotParticipant, Materialized, Dynamic)
 	}
 
-	for _, txId := range transactionOrder {
-		close(unblocks[txId])
-		time.Sleep(STAGGER_DELAY_MILLIS * time.Millisecond)
+	mermaid.AddArrow(Solid, string(event.TxId), readTarget, describeOperation(event), MaterializeOpposite)
+
+	lockLevels := tx.GetLocks().GetLockLevels()
+	lockLevel := lockLevels[key]
+
+	if lockLevel == Read {
+		mermaid.EnsureActivatedOnLevel(1, string(key))
+	}
+
+	mermaid.AddArrow(Solid, readTarget, string(event.TxId), fmt.Sprintf("%v = %v", key, value), AsMaterialized)
+}
+
+// isReadingSnapshots tells whether transactions of level read from a
+// snapshot, optimistic ones only use theirs to validate against and two phase
+// locking reads the latest committed value under its lock.
+func isReadingSnapshots(level TransactionLevel) bool {
+	switch level {
+	case SnapshotIsolationLevel, SerializableSnapshotIsolationLevel:
+		return true
+	default:
+		return false
 	}
+}
 
-	c := make(chan struct{})
-	go func() {
-		defer close(c)
-		wg.Wait()
-	}()
+// activationLevel tells how many times key is activated for the lock tx holds
+// on it, once for a read lock and twice for a write lock.
+func activationLevel(tx Transaction, key Key) int {
+	switch tx.GetLocks().GetLockLevels()[key] {
+	case Read:
+		return 1
+	case ReadWrite:
+		return 2
+	default:
+		return 0
+	}
+}
+
+func describeOperation(event Event) string {
+	switch event.OperationType {
+	case ReadOperation:
+		return "get " + string(event.Key)
+	case ScanOperation:
+		return fmt.Sprintf("scan %v..%v", event.Key, event.End)
+	case DeleteOperation:
+		return "delete " + string(event.Key)
+	case LockOperation:
+		return fmt.Sprintf("lock %v %v", event.Key, event.LockMode)
+	case LockTableOperation:
+		return fmt.Sprintf("lock table in %v mode", event.LockLevel)
+	default:
+		return fmt.Sprintf("set %v = %v", event.Key, event.To)
+	}
+}
+
+// isOverTransaction tells whether the event is drawn as a note over its
+// transaction rather than as arrows to a row, it does not touch a single row.
+func isOverTransaction(event Event) bool {
+	return event.OperationType == ScanOperation || event.OperationType == LockTableOperation
+}
 
-	select {
-	case <-c:
-		return mermaid.Build(), nil
-	case <-time.After(TIMEOUT_SECS * time.Second):
-		return mermaid.Build(), fmt.Errorf("timed out after %v secs", TIMEOUT_SECS)
+func addRefusal(mermaid *MermaidBuilder, event Event, err error) {
+	if isOverTransaction(event) {
+		mermaid.AddNote(string(event.TxId), err.Error())
+	} else {
+		mermaid.AddArrow(Cross, string(event.Key), string(event.TxId), err.Error(), AsMaterialized)
 	}
 }
 
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"testing"
 )
 
@@ -20,27 +21,162 @@ func TestPlayEventsProducingMermaid(t *testing.T) {
 		t.Errorf("expted PlayEvents to succeed, got error: %v", err)
 	}
 
-	expectedMermaid := `
-sequenceDiagram
+	expectedMermaid := `sequenceDiagram
     actor t1
     participant x
     actor t2
-    note right of x: x = 1
+    note over x: {"Key":"x","Committed":"1","LatestUncommitted":"1","UncommittedByTxId":{}}
     t1 ->> x: set x = 2
     activate x
     activate x
     x ->> t1: ok
+    note over x: {"Key":"x","Committed":"1","LatestUncommitted":"2","UncommittedByTxId":{"t1":"2"}}
     t2 -->> x: get x
+    note over x: granted t1 (write), waiting t2 (read)
     t1 ->> x: commit
+    x ->> t1: ok
     deactivate x
     deactivate x
-    note right of x: x = 2
+    note over x: {"Key":"x","Committed":"2","LatestUncommitted":"2","UncommittedByTxId":{}}
     t2 ->> x: get x
     activate x
     x ->> t2: x = 2
     t2 ->> x: commit
+    x ->> t2: ok
+    deactivate x
+    note over x: {"Key":"x","Committed":"2","LatestUncommitted":"2","UncommittedByTxId":{}}
+`
+
+	if productedMermaid != expectedMermaid {
+		t.Errorf("got %v, want %v", productedMermaid, expectedMermaid)
+	}
+}
+
+func TestPlayEventsIsReproducible(t *testing.T) {
+	events := func() []Event {
+		return []Event{
+			NewWrite("t1", TwoPhaseLockingLevel, "x", "2"),
+			NewWrite("t2", TwoPhaseLockingLevel, "y", "2"),
+			NewWrite("t1", TwoPhaseLockingLevel, "y", "3"),
+			NewWrite("t2", TwoPhaseLockingLevel, "x", "3"),
+			NewCommit("t1", TwoPhaseLockingLevel),
+			NewCommit("t2", TwoPhaseLockingLevel),
+		}
+	}
+
+	var first string
+	for i := 0; i < 20; i++ {
+		table := NewTable()
+		table.Data["x"] = NewRow("x", "1")
+		table.Data["y"] = NewRow("y", "1")
+
+		producedMermaid, err := PlayEvents(events(), &table)
+		if err != nil {
+			t.Fatalf("expected PlayEvents to succeed, got error: %v", err)
+		}
+
+		if i == 0 {
+			first = producedMermaid
+			continue
+		}
+
+		if producedMermaid != first {
+			t.Fatalf("run %v got %v, want %v", i, producedMermaid, first)
+		}
+	}
+}
+
+func TestPlayEventsResumesParkedTransaction(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "1")
+
+	events := []Event{
+		NewWrite("t1", TwoPhaseLockingLevel, "x", "2"),
+		NewWrite("t2", TwoPhaseLockingLevel, "x", "3"),
+		NewCommit("t2", TwoPhaseLockingLevel),
+		NewCommit("t1", TwoPhaseLockingLevel),
+	}
+
+	if _, err := PlayEvents(events, &table); err != nil {
+		t.Fatalf("expected PlayEvents to succeed, got error: %v", err)
+	}
+
+	for _, event := range events {
+		if event.Err != nil {
+			t.Errorf("got %v for event %v, want no error", event.Err, event.Position)
+		}
+	}
+
+	if committed := table.Data["x"].Committed; committed != "3" {
+		t.Errorf("got %v, want %v", committed, "3")
+	}
+}
+
+func TestPlayEventsFailsWhenTransactionNeverGetsItsLock(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "1")
+
+	events := []Event{
+		NewWrite("t1", TwoPhaseLockingLevel, "x", "2"),
+		NewWrite("t2", TwoPhaseLockingLevel, "x", "3"),
+	}
+
+	if _, err := PlayEvents(events, &table); err == nil {
+		t.Error("expected PlayEvents to fail, t2 is still waiting for x")
+	}
+
+	if !errors.Is(events[1].Err, errNoEventLeft) {
+		t.Errorf("got %v, want %v", events[1].Err, errNoEventLeft)
+	}
+
+	if table.LockManager.IsWaiting("t2") {
+		t.Error("expected the wait of t2 to be interrupted")
+	}
+}
+
+func TestPlayEventsRollingBack(t *testing.T) {
+	table := NewTable()
+	(&table).Data["x"] = NewRow("x", "1")
+
+	events := []Event{
+		NewWrite("t1", TwoPhaseLockingLevel, "x", "2"),
+		NewWrite("t2", TwoPhaseLockingLevel, "x", "3"),
+		NewRollback("t1", TwoPhaseLockingLevel),
+		NewCommit("t2", TwoPhaseLockingLevel),
+	}
+
+	productedMermaid, err := PlayEvents(events, &table)
+	if err != nil {
+		t.Errorf("expted PlayEvents to succeed, got error: %v", err)
+	}
+
+	expectedMermaid := `sequenceDiagram
+    actor t1
+    participant x
+    actor t2
+    note over x: {"Key":"x","Committed":"1","LatestUncommitted":"1","UncommittedByTxId":{}}
+    t1 ->> x: set x = 2
+    activate x
+    activate x
+    x ->> t1: ok
+    note over x: {"Key":"x","Committed":"1","LatestUncommitted":"2","UncommittedByTxId":{"t1":"2"}}
+    t2 -->> x: set x = 3
+    note over x: granted t1 (write), waiting t2 (write)
+    t1 ->> x: rollback
+    x ->> t1: ok
+    deactivate x
+    deactivate x
+    note over x: {"Key":"x","Committed":"1","LatestUncommitted":"1","UncommittedByTxId":{}}
+    t2 ->> x: set x = 3
+    activate x
+    activate x
+    x ->> t2: ok
+    note over x: {"Key":"x","Committed":"1","LatestUncommitted":"3","UncommittedByTxId":{"t2":"3"}}
+    t2 ->> x: commit
+    x ->> t2: ok
+    deactivate x
     deactivate x
-    note right of x: x = 2
+    note over x: {"Key":"x","Committed":"3","LatestUncommitted":"3","UncommittedByTxId":{}}
 `
 
 	if productedMermaid != expectedMermaid {
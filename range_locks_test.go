@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRangeLockBlocksInsertUntilCommit(t *testing.T) {
+	table := NewTable()
+	table.Data["employee-1"] = NewRow("employee-1", "sales")
+	table.History = NewHistory()
+
+	events := []Event{
+		NewScan("t1", TwoPhaseLockingLevel, "employee-0", "employee-9"),
+		NewWrite("t2", TwoPhaseLockingLevel, "employee-2", "sales"),
+		NewCommit("t2", TwoPhaseLockingLevel),
+		NewScan("t1", TwoPhaseLockingLevel, "employee-0", "employee-9"),
+		NewCommit("t1", TwoPhaseLockingLevel),
+	}
+
+	if _, err := PlayEvents(events, &table); err != nil {
+		t.Fatalf("expected PlayEvents to succeed, got error: %v", err)
+	}
+
+	want := "t1:s(employee-0..employee-9)=[employee-1=sales] t1:s(employee-0..employee-9)=[employee-1=sales] t1:c " +
+		"t2:w(employee-2)=sales t2:c"
+	if got := table.History.String(); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if got := table.Data["employee-2"].Committed; got != "sales" {
+		t.Errorf("got %v, want %v", got, "sales")
+	}
+}
+
+func TestRangeLockLetsInsertOutsideTheRangeThrough(t *testing.T) {
+	table := NewTable()
+	table.History = NewHistory()
+
+	events := []Event{
+		NewScan("t1", TwoPhaseLockingLevel, "employee-0", "employee-9"),
+		NewWrite("t2", TwoPhaseLockingLevel, "manager-1", "sales"),
+		NewCommit("t2", TwoPhaseLockingLevel),
+		NewCommit("t1", TwoPhaseLockingLevel),
+	}
+
+	if _, err := PlayEvents(events, &table); err != nil {
+		t.Fatalf("expected PlayEvents to succeed, got error: %v", err)
+	}
+
+	want := "t1:s(employee-0..employee-9)=[] t2:w(manager-1)=sales t2:c t1:c"
+	if got := table.History.String(); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestRangeLocksTurnPhantomWriteSkewIntoDeadlock(t *testing.T) {
+	table := NewTable()
+
+	events := []Event{
+		NewScan("t1", TwoPhaseLockingLevel, "room-a-09:00", "room-a-09:59"),
+		NewScan("t2", TwoPhaseLockingLevel, "room-a-09:00", "room-a-09:59"),
+		NewWrite("t1", TwoPhaseLockingLevel, "room-a-09:00", "t1"),
+		NewWrite("t2", TwoPhaseLockingLevel, "room-a-09:30", "t2"),
+		NewCommit("t1", TwoPhaseLockingLevel),
+		NewCommit("t2", TwoPhaseLockingLevel),
+	}
+
+	if _, err := PlayEvents(events, &table); err != nil {
+		t.Fatalf("expected PlayEvents to succeed, got error: %v", err)
+	}
+
+	var deadlockErr *DeadlockError
+	if !errors.As(events[3].Err, &deadlockErr) {
+		t.Errorf("got %v, want deadlock error", events[3].Err)
+	}
+
+	if got := table.Data["room-a-09:00"].Committed; got != "t1" {
+		t.Errorf("got %v, want %v", got, "t1")
+	}
+
+	if _, ok := table.Data["room-a-09:30"]; ok {
+		t.Errorf("expected room-a-09:30 not to be inserted")
+	}
+}
+
+func TestScanWaitingForInsertSeesIt(t *testing.T) {
+	table := NewTable()
+	table.History = NewHistory()
+
+	events := []Event{
+		NewScan("t1", TwoPhaseLockingLevel, "a", "z"),
+		NewCommit("t1", TwoPhaseLockingLevel),
+		NewScan("t3", TwoPhaseLockingLevel, "0", "9"),
+		NewWrite("t2", TwoPhaseLockingLevel, "x", "X"),
+		NewScan("t3", TwoPhaseLockingLevel, "a", "z"),
+		NewCommit("t2", TwoPhaseLockingLevel),
+		NewCommit("t3", TwoPhaseLockingLevel),
+	}
+
+	if _, err := PlayEvents(events, &table); err != nil {
+		t.Fatalf("expected PlayEvents to succeed, got error: %v", err)
+	}
+
+	if got, want := events[4].Observed, Value("[x=X]"); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
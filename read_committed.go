@@ -6,6 +6,8 @@ type ReadCommitted struct {
 	Operations    []Operation
 	locks         *TransactionLocks
 	keysTouched   map[Key]struct{}
+	status        TransactionStatus
+	err           error
 }
 
 func NewReadCommitted(transactionId TransactionId, table *Table) *ReadCommitted {
@@ -13,13 +15,35 @@ func NewReadCommitted(transactionId TransactionId, table *Table) *ReadCommitted
 		TransactionId: transactionId,
 		Table:         table,
 		Operations:    make([]Operation, 0),
-		locks:         NewTransactionLocks(),
+		locks:         NewTransactionLocks(table),
 		keysTouched:   make(map[Key]struct{}),
+		status:        ActiveStatus,
+		err:           nil,
 	}
 }
 
-func (t *ReadCommitted) Set(key Key, value Value) Transaction {
+func (t *ReadCommitted) TrySet(key Key, value Value) error {
+	if err := ensureActive(t.TransactionId, t.status); err != nil {
+		return err
+	}
+
 	row, ok := t.Table.Data[key]
+	if !ok {
+		row = NewRow(key, TombstoneValue())
+	}
+
+	didILock, err := t.locks.Lock(ReadWrite, t.TransactionId, &row)
+	if err != nil {
+		return t.fail(err)
+	}
+	if didILock {
+		defer t.locks.Unlock(t.TransactionId, &row)
+	}
+
+	if ok {
+		row = t.Table.Data[key] // may have changed while waiting for its lock
+	}
+
 	prevValue, prevOk := row.UncommittedByTxId[t.TransactionId]
 
 	if !prevOk {
@@ -27,13 +51,7 @@ func (t *ReadCommitted) Set(key Key, value Value) Transaction {
 	}
 
 	if !ok {
-		row = NewRow(key, value)
-		prevValue = EmptyValue()
-	}
-
-	didILock := t.locks.Lock(ReadWrite, t.TransactionId, &row)
-	if didILock {
-		defer t.locks.Unlock(&row)
+		prevValue = TombstoneValue()
 	}
 
 	t.Operations = append(t.Operations, Operation{
@@ -46,68 +64,148 @@ func (t *ReadCommitted) Set(key Key, value Value) Transaction {
 	row.LatestUncommitted = value
 	row.UncommittedByTxId[t.TransactionId] = value
 	t.Table.Data[key] = row
-	return t
+
+	return nil
 }
 
-func (t *ReadCommitted) Get(key Key) Value {
+// TryDelete leaves a tombstone in place of the value, readers that can see
+// it find the key missing.
+func (t *ReadCommitted) TryDelete(key Key) error {
+	return t.TrySet(key, TombstoneValue())
+}
+
+func (t *ReadCommitted) TryGet(key Key) (Value, error) {
+	if err := ensureActive(t.TransactionId, t.status); err != nil {
+		return EmptyValue(), err
+	}
+
 	row, ok := t.Table.Data[key]
 
 	if !ok {
-		return EmptyValue()
+		return EmptyValue(), nil
 	}
 
-	didILock := t.locks.Lock(Read, t.TransactionId, &row)
+	didILock, err := t.locks.Lock(Read, t.TransactionId, &row)
+	if err != nil {
+		return EmptyValue(), t.fail(err)
+	}
 	if didILock {
-		defer t.locks.Unlock(&row)
+		defer t.locks.Unlock(t.TransactionId, &row)
 	}
+	row = t.Table.Data[key]
 
 	t.keysTouched[key] = struct{}{}
 
 	if uncommitted, ok := row.UncommittedByTxId[t.TransactionId]; ok {
-		return uncommitted
+		return visibleValue(uncommitted), nil
 	}
 
-	return row.Committed
+	return visibleValue(row.Committed), nil
 }
 
-func (t *ReadCommitted) Lock(key Key) Transaction {
+// TryScan sees the rows of the range as last committed, a row inserted and
+// committed between two scans shows up as a phantom in the second one.
+func (t *ReadCommitted) TryScan(from Key, to Key) ([]KeyValue, error) {
+	if err := ensureActive(t.TransactionId, t.status); err != nil {
+		return nil, err
+	}
+
+	return scanRows(t.Table, from, to, t.TryGet)
+}
+
+func (t *ReadCommitted) TryLock(key Key) error {
+	_, err := t.TryLockWith(key, LockMode{Strength: ForUpdate, WaitPolicy: Wait})
+	return err
+}
+
+func (t *ReadCommitted) TryLockWith(key Key, mode LockMode) (bool, error) {
+	if err := ensureActive(t.TransactionId, t.status); err != nil {
+		return false, err
+	}
+
 	row, ok := t.Table.Data[key]
 
 	if !ok {
-		return t
+		return false, nil
 	}
 
-	t.locks.Lock(ReadWrite, t.TransactionId, &row)
+	isLocked, err := t.locks.LockWith(mode, t.TransactionId, &row)
+	if err != nil {
+		return false, t.fail(err)
+	}
 
-	return t
+	return isLocked, nil
 }
 
-func (t *ReadCommitted) Rollback() Transaction {
+func (t *ReadCommitted) TryLockTable(lockLevel LockLevel) error {
+	if err := ensureActive(t.TransactionId, t.status); err != nil {
+		return err
+	}
+
+	if err := t.locks.LockTable(t.TransactionId, lockLevel); err != nil {
+		return t.fail(err)
+	}
+
+	return nil
+}
+
+func (t *ReadCommitted) TryRollback() error {
+	if t.status != ActiveStatus && t.status != AbortedStatus {
+		return ensureActive(t.TransactionId, t.status)
+	}
+
+	t.rollback()
+	t.status = RolledBackStatus
+
+	return nil
+}
+
+func (t *ReadCommitted) rollback() {
 	for i := len(t.Operations) - 1; i >= 0; i-- {
 		op := t.Operations[i]
 
 		row := t.Table.Data[op.Key]
-		row.UncommittedByTxId[t.TransactionId] = op.FromValue
+		row.LatestUncommitted = op.FromValue
+		delete(row.UncommittedByTxId, t.TransactionId)
 		t.Table.Data[op.Key] = row
 	}
 
-	t.locks.UnlockAll()
+	t.locks.UnlockAll(t.TransactionId)
 	t.Operations = make([]Operation, 0)
 	t.keysTouched = make(map[Key]struct{})
+}
 
-	return t
+// fail aborts the transaction after an operation was refused, it stays
+// aborted until rolled back.
+func (t *ReadCommitted) fail(err error) error {
+	t.rollback()
+	t.status = AbortedStatus
+
+	return err
 }
 
-func (t *ReadCommitted) Commit() Transaction {
+func (t *ReadCommitted) TryCommit() error {
+	if err := ensureActive(t.TransactionId, t.status); err != nil {
+		return err
+	}
+
+	if err := t.locks.TakeWound(t.TransactionId); err != nil {
+		t.rollback()
+		t.status = RolledBackStatus
+
+		return err
+	}
+
 	for _, op := range t.Operations {
 		t.Table.SetCommitted(op.Key, op.ToValue, t.TransactionId)
 	}
 
-	t.locks.UnlockAll()
+	t.locks.UnlockAll(t.TransactionId)
 	t.Operations = make([]Operation, 0)
 	t.keysTouched = make(map[Key]struct{})
+	t.status = CommittedStatus
 
-	return t
+	return nil
 }
 
 func (t *ReadCommitted) GetKeysTouched() []Key {
@@ -123,3 +221,67 @@ func (t *ReadCommitted) GetKeysTouched() []Key {
 func (t *ReadCommitted) GetLocks() *TransactionLocks {
 	return t.locks
 }
+
+func (t *ReadCommitted) Set(key Key, value Value) Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TrySet(key, value)
+	return t
+}
+
+func (t *ReadCommitted) Delete(key Key) Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TryDelete(key)
+	return t
+}
+
+func (t *ReadCommitted) Get(key Key) Value {
+	t.status = reopened(t.status)
+	value, err := t.TryGet(key)
+	t.err = err
+	return value
+}
+
+func (t *ReadCommitted) Scan(from Key, to Key) []KeyValue {
+	t.status = reopened(t.status)
+	rows, err := t.TryScan(from, to)
+	t.err = err
+	return rows
+}
+
+func (t *ReadCommitted) Lock(key Key) Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TryLock(key)
+	return t
+}
+
+func (t *ReadCommitted) LockWith(key Key, mode LockMode) Transaction {
+	t.status = reopened(t.status)
+	_, t.err = t.TryLockWith(key, mode)
+	return t
+}
+
+func (t *ReadCommitted) LockTable(lockLevel LockLevel) Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TryLockTable(lockLevel)
+	return t
+}
+
+func (t *ReadCommitted) Rollback() Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TryRollback()
+	return t
+}
+
+func (t *ReadCommitted) Commit() Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TryCommit()
+	return t
+}
+
+func (t *ReadCommitted) GetStatus() TransactionStatus {
+	return t.status
+}
+
+func (t *ReadCommitted) GetError() error {
+	return t.err
+}
@@ -14,26 +14,31 @@ func TestReadSkew(t *testing.T) {
 			NewSnapshotIsolation("2", &table),
 		},
 		{
-			NewTwoPhaseLocking("1", &table),
-			NewTwoPhaseLocking("2", &table),
+			NewSerializableSnapshotIsolation("1", &table),
+			NewSerializableSnapshotIsolation("2", &table),
 		},
 	}
 
 	for _, txPair := range transactionPairs {
-		testReadSkew(t, txPair)
+		testReadSkew(t, txPair, "A")
 	}
 
+	// two phase locking reads the latest committed value under its lock, t1
+	// then comes after t2
+	table = NewTable()
+	table.Data["x"] = NewRow("x", "A")
+	testReadSkew(t, []Transaction{NewTwoPhaseLocking("1", &table), NewTwoPhaseLocking("2", &table)}, "B")
 }
 
-func testReadSkew(t *testing.T, txPair []Transaction) {
+func testReadSkew(t *testing.T, txPair []Transaction, want Value) {
 	t1 := txPair[0]
 	t2 := txPair[1]
 
 	t2.Set("x", "B").Commit()
 	afterT2Commit := t1.Get("x")
 
-	if afterT2Commit != "A" {
-		t.Errorf("got %v, want %v", afterT2Commit, "A")
+	if afterT2Commit != want {
+		t.Errorf("got %v, want %v", afterT2Commit, want)
 	}
 
 }
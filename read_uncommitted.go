@@ -6,6 +6,8 @@ type ReadUncommitted struct {
 	Operations    []Operation
 	locks         *TransactionLocks
 	keysTouched   map[Key]struct{}
+	status        TransactionStatus
+	err           error
 }
 
 func NewReadUncommitted(transactionId TransactionId, table *Table) *ReadUncommitted {
@@ -13,23 +15,39 @@ func NewReadUncommitted(transactionId TransactionId, table *Table) *ReadUncommit
 		TransactionId: transactionId,
 		Table:         table,
 		Operations:    make([]Operation, 0),
-		locks:         NewTransactionLocks(),
+		locks:         NewTransactionLocks(table),
 		keysTouched:   make(map[Key]struct{}),
+		status:        ActiveStatus,
+		err:           nil,
 	}
 }
 
-func (t *ReadUncommitted) Set(key Key, value Value) Transaction {
-	row, ok := t.Table.Data[key]
-	prevValue := row.LatestUncommitted
+func (t *ReadUncommitted) TrySet(key Key, value Value) error {
+	if err := ensureActive(t.TransactionId, t.status); err != nil {
+		return err
+	}
 
+	row, ok := t.Table.Data[key]
 	if !ok {
-		row = NewRow(key, value)
-		prevValue = EmptyValue()
+		row = NewRow(key, TombstoneValue())
 	}
 
-	didILock := t.locks.Lock(ReadWrite, t.TransactionId, &row)
+	didILock, err := t.locks.Lock(ReadWrite, t.TransactionId, &row)
+	if err != nil {
+		return t.fail(err)
+	}
 	if didILock {
-		defer t.locks.Unlock(&row)
+		defer t.locks.Unlock(t.TransactionId, &row)
+	}
+
+	if ok {
+		row = t.Table.Data[key] // may have changed while waiting for its lock
+	}
+
+	prevValue := row.LatestUncommitted
+
+	if !ok {
+		prevValue = TombstoneValue()
 	}
 
 	t.Operations = append(t.Operations, Operation{
@@ -42,39 +60,98 @@ func (t *ReadUncommitted) Set(key Key, value Value) Transaction {
 	row.LatestUncommitted = value
 	t.Table.Data[key] = row
 
-	return t
+	return nil
 }
 
-func (t *ReadUncommitted) Get(key Key) Value {
+// TryDelete leaves a tombstone in place of the value, readers that can see
+// it find the key missing.
+func (t *ReadUncommitted) TryDelete(key Key) error {
+	return t.TrySet(key, TombstoneValue())
+}
+
+func (t *ReadUncommitted) TryGet(key Key) (Value, error) {
+	if err := ensureActive(t.TransactionId, t.status); err != nil {
+		return EmptyValue(), err
+	}
+
 	row, ok := t.Table.Data[key]
 
 	if !ok {
-		return EmptyValue()
+		return EmptyValue(), nil
 	}
 
-	didILock := t.locks.Lock(Read, t.TransactionId, &row)
+	didILock, err := t.locks.Lock(Read, t.TransactionId, &row)
+	if err != nil {
+		return EmptyValue(), t.fail(err)
+	}
 	if didILock {
-		defer t.locks.Unlock(&row)
+		defer t.locks.Unlock(t.TransactionId, &row)
 	}
+	row = t.Table.Data[key]
 
 	t.keysTouched[key] = struct{}{}
 
-	return row.LatestUncommitted
+	return visibleValue(row.LatestUncommitted), nil
 }
 
-func (t *ReadUncommitted) Lock(key Key) Transaction {
+// TryScan sees the latest value of every row in the range, committed or not,
+// including rows whose insert is not committed yet.
+func (t *ReadUncommitted) TryScan(from Key, to Key) ([]KeyValue, error) {
+	if err := ensureActive(t.TransactionId, t.status); err != nil {
+		return nil, err
+	}
+
+	return scanRows(t.Table, from, to, t.TryGet)
+}
+
+func (t *ReadUncommitted) TryLock(key Key) error {
+	_, err := t.TryLockWith(key, LockMode{Strength: ForUpdate, WaitPolicy: Wait})
+	return err
+}
+
+func (t *ReadUncommitted) TryLockWith(key Key, mode LockMode) (bool, error) {
+	if err := ensureActive(t.TransactionId, t.status); err != nil {
+		return false, err
+	}
+
 	row, ok := t.Table.Data[key]
 
 	if !ok {
-		return t
+		return false, nil
 	}
 
-	t.locks.Lock(ReadWrite, t.TransactionId, &row)
+	isLocked, err := t.locks.LockWith(mode, t.TransactionId, &row)
+	if err != nil {
+		return false, t.fail(err)
+	}
 
-	return t
+	return isLocked, nil
 }
 
-func (t *ReadUncommitted) Rollback() Transaction {
+func (t *ReadUncommitted) TryLockTable(lockLevel LockLevel) error {
+	if err := ensureActive(t.TransactionId, t.status); err != nil {
+		return err
+	}
+
+	if err := t.locks.LockTable(t.TransactionId, lockLevel); err != nil {
+		return t.fail(err)
+	}
+
+	return nil
+}
+
+func (t *ReadUncommitted) TryRollback() error {
+	if t.status != ActiveStatus && t.status != AbortedStatus {
+		return ensureActive(t.TransactionId, t.status)
+	}
+
+	t.rollback()
+	t.status = RolledBackStatus
+
+	return nil
+}
+
+func (t *ReadUncommitted) rollback() {
 	for i := len(t.Operations) - 1; i >= 0; i-- {
 		op := t.Operations[i]
 		row := t.Table.Data[op.Key]
@@ -82,23 +159,48 @@ func (t *ReadUncommitted) Rollback() Transaction {
 		t.Table.Data[op.Key] = row
 	}
 
-	t.locks.UnlockAll()
+	t.locks.UnlockAll(t.TransactionId)
 	t.Operations = make([]Operation, 0)
 	t.keysTouched = make(map[Key]struct{})
+}
 
-	return t
+// fail aborts the transaction after an operation was refused, it stays
+// aborted until rolled back.
+func (t *ReadUncommitted) fail(err error) error {
+	t.rollback()
+	t.status = AbortedStatus
+
+	return err
 }
 
-func (t *ReadUncommitted) Commit() Transaction {
+func (t *ReadUncommitted) TryCommit() error {
+	if err := ensureActive(t.TransactionId, t.status); err != nil {
+		return err
+	}
+
+	if err := t.locks.TakeWound(t.TransactionId); err != nil {
+		t.rollback()
+		t.status = RolledBackStatus
+
+		return err
+	}
+
 	for _, op := range t.Operations {
 		t.Table.SetCommitted(op.Key, op.ToValue, t.TransactionId)
 	}
 
-	t.locks.UnlockAll()
+	t.locks.UnlockAll(t.TransactionId)
 	t.Operations = make([]Operation, 0)
 	t.keysTouched = make(map[Key]struct{})
+	t.status = CommittedStatus
 
-	return t
+	return nil
+}
+
+// installsOnWrite tells that a write replaces the latest value of its row as
+// it is made, taking its lock only for the write itself.
+func (t *ReadUncommitted) installsOnWrite() bool {
+	return true
 }
 
 func (t *ReadUncommitted) GetKeysTouched() []Key {
@@ -114,3 +216,67 @@ func (t *ReadUncommitted) GetKeysTouched() []Key {
 func (t *ReadUncommitted) GetLocks() *TransactionLocks {
 	return t.locks
 }
+
+func (t *ReadUncommitted) Set(key Key, value Value) Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TrySet(key, value)
+	return t
+}
+
+func (t *ReadUncommitted) Delete(key Key) Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TryDelete(key)
+	return t
+}
+
+func (t *ReadUncommitted) Get(key Key) Value {
+	t.status = reopened(t.status)
+	value, err := t.TryGet(key)
+	t.err = err
+	return value
+}
+
+func (t *ReadUncommitted) Scan(from Key, to Key) []KeyValue {
+	t.status = reopened(t.status)
+	rows, err := t.TryScan(from, to)
+	t.err = err
+	return rows
+}
+
+func (t *ReadUncommitted) Lock(key Key) Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TryLock(key)
+	return t
+}
+
+func (t *ReadUncommitted) LockWith(key Key, mode LockMode) Transaction {
+	t.status = reopened(t.status)
+	_, t.err = t.TryLockWith(key, mode)
+	return t
+}
+
+func (t *ReadUncommitted) LockTable(lockLevel LockLevel) Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TryLockTable(lockLevel)
+	return t
+}
+
+func (t *ReadUncommitted) Rollback() Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TryRollback()
+	return t
+}
+
+func (t *ReadUncommitted) Commit() Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TryCommit()
+	return t
+}
+
+func (t *ReadUncommitted) GetStatus() TransactionStatus {
+	return t.status
+}
+
+func (t *ReadUncommitted) GetError() error {
+	return t.err
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"sort"
+)
+
+type serializableTransaction struct {
+	begin        int
+	commit       int
+	aborted      bool
+	writes       map[Key]struct{}
+	inConflicts  map[TransactionId]struct{}
+	outConflicts map[TransactionId]struct{}
+}
+
+func (s *serializableTransaction) isActive() bool {
+	return s.commit == 0 && !s.aborted
+}
+
+// RwAntidependencies tracks the rw-antidependencies between concurrent
+// serializable snapshot transactions: reader ->rw writer whenever the reader
+// did not see a version written by the writer.
+type RwAntidependencies struct {
+	clock        int
+	transactions map[TransactionId]*serializableTransaction
+	sireadLocks  map[Key]map[TransactionId]struct{}
+	sireadRanges map[TransactionId][]keyRange
+}
+
+func NewRwAntidependencies() *RwAntidependencies {
+	return &RwAntidependencies{
+		clock:        0,
+		transactions: make(map[TransactionId]*serializableTransaction),
+		sireadLocks:  make(map[Key]map[TransactionId]struct{}),
+		sireadRanges: make(map[TransactionId][]keyRange),
+	}
+}
+
+func (r *RwAntidependencies) Begin(txId TransactionId) {
+	if tx, ok := r.transactions[txId]; ok && tx.isActive() {
+		return
+	}
+
+	r.clock++
+	r.transactions[txId] = &serializableTransaction{
+		begin:        r.clock,
+		commit:       0,
+		aborted:      false,
+		writes:       make(map[Key]struct{}),
+		inConflicts:  make(map[TransactionId]struct{}),
+		outConflicts: make(map[TransactionId]struct{}),
+	}
+}
+
+func (r *RwAntidependencies) RecordRead(txId TransactionId, key Key) {
+	reader, ok := r.transactions[txId]
+	if !ok {
+		return
+	}
+
+	if _, ok := r.sireadLocks[key]; !ok {
+		r.sireadLocks[key] = make(map[TransactionId]struct{})
+	}
+	r.sireadLocks[key][txId] = struct{}{}
+
+	for writerId, writer := range r.transactions {
+		if writerId == txId || writer.aborted {
+			continue
+		}
+
+		if _, wroteKey := writer.writes[key]; !wroteKey {
+			continue
+		}
+
+		isInvisibleToReader := writer.commit == 0 || writer.commit > reader.begin
+		if isInvisibleToReader {
+			r.addConflict(txId, writerId)
+		}
+	}
+}
+
+// RecordScan takes a SIREAD lock on a range of keys, including the ones that
+// do not exist yet. The keys the scan finds are read one by one and recorded
+// by RecordRead.
+func (r *RwAntidependencies) RecordScan(txId TransactionId, from Key, to Key) {
+	if _, ok := r.transactions[txId]; !ok {
+		return
+	}
+
+	r.sireadRanges[txId] = append(r.sireadRanges[txId], keyRange{from: from, to: to})
+}
+
+func (r *RwAntidependencies) RecordWrite(txId TransactionId, key Key) {
+	writer, ok := r.transactions[txId]
+	if !ok {
+		return
+	}
+
+	writer.writes[key] = struct{}{}
+
+	for readerId := range r.sireadLocks[key] {
+		reader := r.transactions[readerId]
+		if readerId == txId || reader.aborted {
+			continue
+		}
+
+		isConcurrent := reader.commit == 0 || reader.commit > writer.begin
+		if isConcurrent {
+			r.addConflict(readerId, txId)
+		}
+	}
+
+	for readerId, ranges := range r.sireadRanges {
+		reader := r.transactions[readerId]
+		if readerId == txId || reader.aborted || !isInAnyRange(key, ranges) {
+			continue
+		}
+
+		isConcurrent := reader.commit == 0 || reader.commit > writer.begin
+		if isConcurrent {
+			r.addConflict(readerId, txId)
+		}
+	}
+}
+
+func isInAnyRange(key Key, ranges []keyRange) bool {
+	for _, keyRange := range ranges {
+		if keyRange.contains(key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *RwAntidependencies) addConflict(readerId, writerId TransactionId) {
+	r.transactions[readerId].outConflicts[writerId] = struct{}{}
+	r.transactions[writerId].inConflicts[readerId] = struct{}{}
+}
+
+// DangerousStructure returns the first T_in ->rw T_pivot ->rw T_out chain that
+// txId takes part in where T_out committed before the other two, ignoring
+// aborted transactions. Structures whose T_out commits later are serializable.
+func (r *RwAntidependencies) DangerousStructure(txId TransactionId) ([]TransactionId, bool) {
+	if _, ok := r.transactions[txId]; !ok {
+		return nil, false
+	}
+
+	pivots := []TransactionId{txId}
+	pivots = append(pivots, r.liveConflicts(r.transactions[txId].inConflicts)...)
+	pivots = append(pivots, r.liveConflicts(r.transactions[txId].outConflicts)...)
+
+	for _, pivotId := range pivots {
+		pivot := r.transactions[pivotId]
+
+		for _, inId := range r.liveConflicts(pivot.inConflicts) {
+			for _, outId := range r.liveConflicts(pivot.outConflicts) {
+				isTouchingTx := inId == txId || pivotId == txId || outId == txId
+				if isTouchingTx && r.committedFirst(outId, inId, pivotId) {
+					return []TransactionId{inId, pivotId, outId}, true
+				}
+			}
+		}
+	}
+
+	return nil, false
+}
+
+func (r *RwAntidependencies) committedFirst(txId TransactionId, others ...TransactionId) bool {
+	commit := r.transactions[txId].commit
+	if commit == 0 {
+		return false
+	}
+
+	for _, otherId := range others {
+		otherCommit := r.transactions[otherId].commit
+		if otherId != txId && otherCommit != 0 && otherCommit < commit {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r *RwAntidependencies) liveConflicts(conflicts map[TransactionId]struct{}) []TransactionId {
+	res := make([]TransactionId, 0)
+
+	for txId := range conflicts {
+		if r.transactions[txId].aborted {
+			continue
+		}
+		res = append(res, txId)
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i] < res[j] })
+
+	return res
+}
+
+func (r *RwAntidependencies) Commit(txId TransactionId) {
+	tx, ok := r.transactions[txId]
+	if !ok {
+		return
+	}
+
+	r.clock++
+	tx.commit = r.clock
+
+	r.prune()
+}
+
+func (r *RwAntidependencies) Abort(txId TransactionId) {
+	tx, ok := r.transactions[txId]
+	if !ok {
+		return
+	}
+
+	tx.aborted = true
+
+	for key, readers := range r.sireadLocks {
+		delete(readers, txId)
+		if len(readers) == 0 {
+			delete(r.sireadLocks, key)
+		}
+	}
+
+	delete(r.sireadRanges, txId)
+
+	r.prune()
+}
+
+// prune forgets the finished transactions that can no longer take part in a
+// dangerous structure with a running transaction, along with their SIREAD
+// locks. A committed transaction is kept while a running one started before
+// it committed, like a version vacuum keeps for the oldest xmin, and while one
+// of its conflicts is kept for that reason, a running transaction may still
+// make it the T_out of a structure pivoting on that conflict.
+func (r *RwAntidependencies) prune() {
+	oldestBegin := r.clock + 1
+	for _, tx := range r.transactions {
+		if tx.isActive() {
+			oldestBegin = min(oldestBegin, tx.begin)
+		}
+	}
+
+	isOverlapping := func(tx *serializableTransaction) bool {
+		return tx.isActive() || (!tx.aborted && tx.commit > oldestBegin)
+	}
+
+	pruned := make([]TransactionId, 0)
+	for txId, tx := range r.transactions {
+		if isOverlapping(tx) {
+			continue
+		}
+
+		isNeeded := false
+		if !tx.aborted {
+			for _, conflictId := range append(r.liveConflicts(tx.inConflicts), r.liveConflicts(tx.outConflicts)...) {
+				isNeeded = isNeeded || isOverlapping(r.transactions[conflictId])
+			}
+		}
+
+		if !isNeeded {
+			pruned = append(pruned, txId)
+		}
+	}
+
+	for _, txId := range pruned {
+		delete(r.transactions, txId)
+		delete(r.sireadRanges, txId)
+
+		for key, readers := range r.sireadLocks {
+			delete(readers, txId)
+			if len(readers) == 0 {
+				delete(r.sireadLocks, key)
+			}
+		}
+	}
+
+	for _, tx := range r.transactions {
+		for _, txId := range pruned {
+			delete(tx.inConflicts, txId)
+			delete(tx.outConflicts, txId)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestScan(t *testing.T) {
+	table := NewTable()
+	transactions := []Transaction{
+		NewReadUncommitted("1", &table),
+		NewReadCommitted("1", &table),
+		NewSnapshotIsolation("1", &table),
+		NewTwoPhaseLocking("1", &table),
+		NewSerializableSnapshotIsolation("1", &table),
+	}
+
+	for _, tx := range transactions {
+		table = NewTable()
+		table.Data["a"] = NewRow("a", "A")
+		table.Data["c"] = NewRow("c", "C")
+		table.Data["d"] = NewRow("d", "D")
+		table.Data["e"] = NewRow("e", "E")
+
+		rows := tx.Delete("d").Set("b", "B").Scan("b", "d")
+		if got, want := fmt.Sprint(rows), "[b=B c=C]"; got != want {
+			t.Errorf("got %v, want %v", got, want)
+		}
+
+		tx.Commit()
+	}
+}
+
+func TestScanVisibility(t *testing.T) {
+	tests := []struct {
+		name               string
+		newTransaction     func(txId TransactionId, table *Table) Transaction
+		wantDuringInsert   string
+		wantAfterInsert    string
+		wantNewTransaction string
+	}{
+		{
+			name:               "read uncommitted",
+			newTransaction:     func(txId TransactionId, table *Table) Transaction { return NewReadUncommitted(txId, table) },
+			wantDuringInsert:   "[x=A y=B]",
+			wantAfterInsert:    "[x=A y=B]",
+			wantNewTransaction: "[x=A y=B]",
+		},
+		{
+			name:               "read committed",
+			newTransaction:     func(txId TransactionId, table *Table) Transaction { return NewReadCommitted(txId, table) },
+			wantDuringInsert:   "[x=A]",
+			wantAfterInsert:    "[x=A y=B]",
+			wantNewTransaction: "[x=A y=B]",
+		},
+		{
+			name:               "snapshot isolation",
+			newTransaction:     func(txId TransactionId, table *Table) Transaction { return NewSnapshotIsolation(txId, table) },
+			wantDuringInsert:   "[x=A]",
+			wantAfterInsert:    "[x=A]",
+			wantNewTransaction: "[x=A y=B]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := NewTable()
+			table.Data["x"] = NewRow("x", "A")
+
+			t1 := tt.newTransaction("1", &table)
+			t2 := tt.newTransaction("2", &table)
+
+			t1.Scan("a", "z")
+			t2.Set("y", "B")
+
+			if got := fmt.Sprint(t1.Scan("a", "z")); got != tt.wantDuringInsert {
+				t.Errorf("during insert: got %v, want %v", got, tt.wantDuringInsert)
+			}
+
+			t2.Commit()
+
+			if got := fmt.Sprint(t1.Scan("a", "z")); got != tt.wantAfterInsert {
+				t.Errorf("after insert: got %v, want %v", got, tt.wantAfterInsert)
+			}
+
+			if got := fmt.Sprint(tt.newTransaction("3", &table).Scan("a", "z")); got != tt.wantNewTransaction {
+				t.Errorf("new transaction: got %v, want %v", got, tt.wantNewTransaction)
+			}
+		})
+	}
+}
+
+func TestScanRecordsRangeInHistory(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "A")
+	table.History = NewHistory()
+
+	events := []Event{
+		NewScan("t1", ReadCommittedLevel, "a", "z"),
+		NewWrite("t2", ReadCommittedLevel, "y", "B"),
+		NewCommit("t2", ReadCommittedLevel),
+		NewScan("t1", ReadCommittedLevel, "a", "z"),
+		NewCommit("t1", ReadCommittedLevel),
+	}
+
+	if _, err := PlayEvents(events, &table); err != nil {
+		t.Fatalf("expected PlayEvents to succeed, got error: %v", err)
+	}
+
+	want := "t1:s(a..z)=[x=A] t2:w(y)=B t2:c t1:s(a..z)=[x=A y=B] t1:c"
+	if got := table.History.String(); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	anomalies := table.History.Classify()
+	if len(anomalies) != 2 {
+		t.Fatalf("got %v, want a G-single and a G2 anomaly", anomalies)
+	}
+
+	want = "G-single (read skew): t1 -rw(y)-> t2 -wr(y)-> t1"
+	if got := anomalies[0].String(); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSerializableSnapshotIsolationPreventsPhantomWriteSkew(t *testing.T) {
+	table := NewTable()
+
+	t1 := NewSerializableSnapshotIsolation("1", &table)
+	t2 := NewSerializableSnapshotIsolation("2", &table)
+
+	t1.Scan("room-a-09:00", "room-a-09:59")
+	t2.Scan("room-a-09:00", "room-a-09:59")
+	t1.Set("room-a-09:00", "1")
+	t2.Set("room-a-09:30", "2")
+
+	if err := t1.TryCommit(); err != nil {
+		t.Fatalf("expected first commit to succeed, got error: %v", err)
+	}
+
+	if err := t2.TryCommit(); !errors.Is(err, ErrSerializationFailure) {
+		t.Errorf("got %v, want %v", err, ErrSerializationFailure)
+	}
+}
+
+func TestPlayEventsScanning(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "A")
+	table.Data["y"] = NewRow("y", "B")
+
+	events := []Event{
+		NewScan("t1", ReadCommittedLevel, "a", "z"),
+		NewScan("t1", ReadCommittedLevel, "0", "9"),
+		NewCommit("t1", ReadCommittedLevel),
+	}
+
+	mermaid, err := PlayEvents(events, &table)
+	if err != nil {
+		t.Fatalf("expected PlayEvents to succeed, got error: %v", err)
+	}
+
+	for _, want := range []string{
+		"t1 ->> x: scan a..z",
+		"x ->> t1: x = A",
+		"t1 ->> y: scan a..z",
+		"y ->> t1: y = B",
+		"note over t1: scan 0..9 found no rows",
+	} {
+		if !strings.Contains(mermaid, want) {
+			t.Errorf("expected %q in\n%v", want, mermaid)
+		}
+	}
+}
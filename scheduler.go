@@ -0,0 +1,204 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// errNoEventLeft interrupts the lock waits of the transactions still parked
+// once every event was played.
+var errNoEventLeft = errors.New("no event left to release the lock")
+
+type scheduledStep struct {
+	run       func()
+	onBlocked func()
+}
+
+type scheduledTransaction struct {
+	txId    TransactionId
+	steps   chan func()
+	settled chan bool
+	resume  chan struct{}
+	parked  *scheduledStep
+	backlog []scheduledStep
+}
+
+// Scheduler runs the steps of concurrent transactions one at a time, in the
+// order they were scheduled. Every transaction has its own goroutine, so a
+// step can block on a lock. The transaction is then parked, its later steps
+// are held back and the steps of other transactions go on until the lock
+// manager grants the lock, at which point the parked transaction is resumed
+// before anything else runs.
+type Scheduler struct {
+	mu           sync.Mutex
+	lockManager  *LockManager
+	transactions map[TransactionId]*scheduledTransaction
+	order        []TransactionId
+}
+
+func NewScheduler(lockManager *LockManager) *Scheduler {
+	return &Scheduler{
+		mu:           sync.Mutex{},
+		lockManager:  lockManager,
+		transactions: make(map[TransactionId]*scheduledTransaction),
+		order:        make([]TransactionId, 0),
+	}
+}
+
+// Schedule runs step on the goroutine of txId and returns once it finished
+// or blocked on a lock, in which case onBlocked is called. Steps of a parked
+// transaction are queued until it is resumed.
+func (s *Scheduler) Schedule(txId TransactionId, run func(), onBlocked func()) {
+	tx := s.ensureTransaction(txId)
+	step := scheduledStep{run: run, onBlocked: onBlocked}
+
+	if tx.parked != nil {
+		tx.backlog = append(tx.backlog, step)
+		return
+	}
+
+	s.runStep(tx, step)
+	s.resumeGranted()
+}
+
+// Wait resumes the parked transactions whose lock was granted, or whose wait
+// times out, then stops the goroutines of the transactions. It fails if some
+// of them are still parked, they will never get their locks, after
+// interrupting their waits with errNoEventLeft.
+func (s *Scheduler) Wait() error {
+	s.resumeGranted()
+
+	for progressed := true; progressed; {
+		progressed = false
+
+		for _, txId := range s.order {
+			if tx := s.transaction(txId); tx.parked != nil && s.lockManager.HasWaitDeadline(txId) {
+				progressed = true
+				s.resume(tx)
+				s.resumeGranted()
+			}
+		}
+	}
+
+	parked := make([]TransactionId, 0)
+	for _, txId := range s.order {
+		if s.transaction(txId).parked != nil {
+			parked = append(parked, txId)
+		}
+	}
+
+	for _, txId := range parked {
+		for tx := s.transaction(txId); tx.parked != nil; {
+			tx.backlog = nil
+			s.lockManager.Interrupt(txId, errNoEventLeft)
+			s.resume(tx)
+			s.resumeGranted()
+		}
+	}
+
+	for _, txId := range s.order {
+		close(s.transaction(txId).steps)
+	}
+
+	if len(parked) > 0 {
+		return fmt.Errorf("transactions %v are still waiting for locks", parked)
+	}
+
+	return nil
+}
+
+func (s *Scheduler) Waiting(txId TransactionId) {
+	if tx := s.transaction(txId); tx != nil {
+		tx.settled <- true
+	}
+}
+
+func (s *Scheduler) Resumed(txId TransactionId) {
+	if tx := s.transaction(txId); tx != nil {
+		<-tx.resume
+	}
+}
+
+func (s *Scheduler) transaction(txId TransactionId) *scheduledTransaction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.transactions[txId]
+}
+
+func (s *Scheduler) ensureTransaction(txId TransactionId) *scheduledTransaction {
+	if tx := s.transaction(txId); tx != nil {
+		return tx
+	}
+
+	tx := &scheduledTransaction{
+		txId:    txId,
+		steps:   make(chan func()),
+		settled: make(chan bool, 1),
+		resume:  make(chan struct{}),
+		parked:  nil,
+		backlog: make([]scheduledStep, 0),
+	}
+
+	s.mu.Lock()
+	s.transactions[txId] = tx
+	s.order = append(s.order, txId)
+	s.mu.Unlock()
+
+	go func() {
+		for run := range tx.steps {
+			run()
+			tx.settled <- false
+		}
+	}()
+
+	return tx
+}
+
+func (s *Scheduler) runStep(tx *scheduledTransaction, step scheduledStep) {
+	tx.steps <- step.run
+	s.settle(tx, step)
+}
+
+// settle waits until the running step of tx either finished or blocked.
+func (s *Scheduler) settle(tx *scheduledTransaction, step scheduledStep) {
+	if blocked := <-tx.settled; !blocked {
+		tx.parked = nil
+		return
+	}
+
+	tx.parked = &step
+	step.onBlocked()
+}
+
+// resumeGranted resumes the parked transactions whose lock was granted, in
+// the order they first appeared, until none of them can make progress.
+func (s *Scheduler) resumeGranted() {
+	for progressed := true; progressed; {
+		progressed = false
+
+		for _, txId := range s.order {
+			tx := s.transaction(txId)
+			if tx.parked == nil || s.lockManager.IsWaiting(txId) {
+				continue
+			}
+
+			progressed = true
+			s.resume(tx)
+		}
+	}
+}
+
+// resume lets the parked step of tx go on once its wait is over, blocking
+// until it is, then runs its backlog until it blocks again.
+func (s *Scheduler) resume(tx *scheduledTransaction) {
+	tx.resume <- struct{}{}
+	s.settle(tx, *tx.parked)
+
+	for tx.parked == nil && len(tx.backlog) > 0 {
+		step := tx.backlog[0]
+		tx.backlog = tx.backlog[1:]
+		s.runStep(tx, step)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+)
+
+type DependencyType int
+
+const (
+	WWDependency DependencyType = iota
+	WRDependency
+	RWDependency
+)
+
+func (d DependencyType) String() string {
+	switch d {
+	case WWDependency:
+		return "ww"
+	case WRDependency:
+		return "wr"
+	case RWDependency:
+		return "rw"
+	default:
+		return fmt.Sprintf("DependencyType(%d)", int(d))
+	}
+}
+
+// Conflict is an edge of a serialization graph, From has to come before To
+// in any equivalent serial order because of their operations on Key.
+type Conflict struct {
+	From TransactionId
+	To   TransactionId
+	Type DependencyType
+	Key  Key
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("%v -%v(%v)-> %v", c.From, c.Type, c.Key, c.To)
+}
+
+// CommittedTransactions returns the transactions whose last commit or abort
+// in the history is a commit, in the order they first appear.
+func (h *History) CommittedTransactions() []TransactionId {
+	isCommitted := make(map[TransactionId]bool)
+	order := make([]TransactionId, 0)
+
+	for _, operation := range h.GetOperations() {
+		if _, ok := isCommitted[operation.TxId]; !ok {
+			order = append(order, operation.TxId)
+			isCommitted[operation.TxId] = false
+		}
+
+		switch operation.OperationType {
+		case Commit:
+			isCommitted[operation.TxId] = true
+		case Rollback:
+			isCommitted[operation.TxId] = false
+		}
+	}
+
+	res := make([]TransactionId, 0)
+	for _, txId := range order {
+		if isCommitted[txId] {
+			res = append(res, txId)
+		}
+	}
+
+	return res
+}
+
+// Conflicts returns the edges of the direct serialization graph of the
+// committed transactions. A ww edge orders two versions of a key, a wr edge
+// goes from the writer of the version a read observed to the reader and an
+// rw edge from the reader to the writer of the version after it. What a read
+// observed is found from the value it returned, so a read from a snapshot
+// depends on the version it saw, not on the latest write before it. A scan
+// reads every key of its range.
+func (h *History) Conflicts() []Conflict {
+	return h.dependencyGraph().edges
+}
+
+// CheckConflictSerializable returns an equivalent serial order of the
+// committed transactions, or a NotConflictSerializableError holding a cycle
+// of the serialization graph.
+func (h *History) CheckConflictSerializable() ([]TransactionId, error) {
+	transactions := h.CommittedTransactions()
+	conflicts := h.Conflicts()
+
+	if cycle, ok := findConflictCycle(transactions, conflicts); ok {
+		return nil, &NotConflictSerializableError{Cycle: cycle}
+	}
+
+	order := make([]TransactionId, 0)
+	for len(order) < len(transactions) {
+		for _, txId := range transactions {
+			if slices.Contains(order, txId) {
+				continue
+			}
+
+			isReady := true
+			for _, conflict := range conflicts {
+				if conflict.To == txId && !slices.Contains(order, conflict.From) {
+					isReady = false
+					break
+				}
+			}
+
+			if isReady {
+				order = append(order, txId)
+				break
+			}
+		}
+	}
+
+	return order, nil
+}
+
+func findConflictCycle(transactions []TransactionId, conflicts []Conflict) ([]Conflict, bool) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make(map[TransactionId]int)
+	path := make([]Conflict, 0)
+
+	var walk func(txId TransactionId) ([]Conflict, bool)
+	walk = func(txId TransactionId) ([]Conflict, bool) {
+		state[txId] = visiting
+
+		for _, conflict := range conflicts {
+			if conflict.From != txId {
+				continue
+			}
+
+			path = append(path, conflict)
+
+			switch state[conflict.To] {
+			case visiting:
+				for i, edge := range path {
+					if edge.From == conflict.To {
+						return append([]Conflict{}, path[i:]...), true
+					}
+				}
+			case unvisited:
+				if cycle, ok := walk(conflict.To); ok {
+					return cycle, true
+				}
+			}
+
+			path = path[:len(path)-1]
+		}
+
+		state[txId] = visited
+		return nil, false
+	}
+
+	for _, txId := range transactions {
+		if state[txId] != unvisited {
+			continue
+		}
+
+		if cycle, ok := walk(txId); ok {
+			return cycle, true
+		}
+	}
+
+	return nil, false
+}
@@ -0,0 +1,331 @@
+package main
+
+type SerializableSnapshotIsolation struct {
+	TransactionId TransactionId
+	Table         *Table
+	Operations    []Operation
+	locks         *TransactionLocks
+	keysTouched   map[Key]struct{}
+	status        TransactionStatus
+	err           error
+}
+
+func NewSerializableSnapshotIsolation(transactionId TransactionId, table *Table) *SerializableSnapshotIsolation {
+	t := &SerializableSnapshotIsolation{
+		TransactionId: transactionId,
+		Table:         table,
+		Operations:    make([]Operation, 0),
+		locks:         NewTransactionLocks(table),
+		keysTouched:   make(map[Key]struct{}),
+		status:        ActiveStatus,
+		err:           nil,
+	}
+
+	t.begin()
+
+	return t
+}
+
+func (t *SerializableSnapshotIsolation) begin() {
+	t.Table.EnsureSnapshotTaken(t.TransactionId)
+	t.Table.rwAntidependencies.Begin(t.TransactionId)
+}
+
+func (t *SerializableSnapshotIsolation) TrySet(key Key, value Value) error {
+	if err := ensureActive(t.TransactionId, t.status); err != nil {
+		return err
+	}
+
+	t.begin()
+
+	row, ok := t.Table.Data[key]
+	if !ok {
+		row = NewRow(key, TombstoneValue())
+	}
+
+	didILock, err := t.locks.Lock(ReadWrite, t.TransactionId, &row)
+	if err != nil {
+		return t.fail(err)
+	}
+	if didILock {
+		defer t.locks.Unlock(t.TransactionId, &row)
+	}
+
+	if ok {
+		row = t.Table.Data[key] // may have changed while waiting for its lock
+	}
+
+	prevValue, prevOk := row.UncommittedByTxId[t.TransactionId]
+
+	if !prevOk {
+		prevValue = row.Committed
+	}
+
+	if !ok {
+		prevValue = TombstoneValue()
+	}
+
+	t.Operations = append(t.Operations, Operation{
+		Key:       key,
+		FromValue: prevValue,
+		ToValue:   value,
+	})
+
+	t.keysTouched[key] = struct{}{}
+	row.LatestUncommitted = value
+	row.UncommittedByTxId[t.TransactionId] = value
+	t.Table.Data[key] = row
+	t.Table.rwAntidependencies.RecordWrite(t.TransactionId, key)
+
+	return nil
+}
+
+// TryDelete leaves a tombstone in place of the value, readers that can see
+// it find the key missing.
+func (t *SerializableSnapshotIsolation) TryDelete(key Key) error {
+	return t.TrySet(key, TombstoneValue())
+}
+
+func (t *SerializableSnapshotIsolation) TryGet(key Key) (Value, error) {
+	if err := ensureActive(t.TransactionId, t.status); err != nil {
+		return EmptyValue(), err
+	}
+
+	t.begin()
+	t.Table.rwAntidependencies.RecordRead(t.TransactionId, key)
+
+	row, ok := t.Table.Data[key]
+
+	if !ok {
+		return EmptyValue(), nil
+	}
+
+	didILock, err := t.locks.Lock(Read, t.TransactionId, &row)
+	if err != nil {
+		return EmptyValue(), t.fail(err)
+	}
+	if didILock {
+		defer t.locks.Unlock(t.TransactionId, &row)
+	}
+	row = t.Table.Data[key]
+
+	t.keysTouched[key] = struct{}{}
+
+	if uncommitted, ok := row.UncommittedByTxId[t.TransactionId]; ok {
+		return visibleValue(uncommitted), nil
+	}
+
+	val, _ := t.Table.GetCommitted(key, t.TransactionId)
+	return visibleValue(val), nil
+}
+
+// TryScan sees the rows of the range in the snapshot and takes a SIREAD lock
+// on the whole range, so that inserting into it is an rw-antidependency too.
+func (t *SerializableSnapshotIsolation) TryScan(from Key, to Key) ([]KeyValue, error) {
+	if err := ensureActive(t.TransactionId, t.status); err != nil {
+		return nil, err
+	}
+
+	t.begin()
+	t.Table.rwAntidependencies.RecordScan(t.TransactionId, from, to)
+
+	return scanRows(t.Table, from, to, t.TryGet)
+}
+
+func (t *SerializableSnapshotIsolation) TryLock(key Key) error {
+	_, err := t.TryLockWith(key, LockMode{Strength: ForUpdate, WaitPolicy: Wait})
+	return err
+}
+
+func (t *SerializableSnapshotIsolation) TryLockWith(key Key, mode LockMode) (bool, error) {
+	if err := ensureActive(t.TransactionId, t.status); err != nil {
+		return false, err
+	}
+
+	t.begin()
+
+	row, ok := t.Table.Data[key]
+
+	if !ok {
+		return false, nil
+	}
+
+	isLocked, err := t.locks.LockWith(mode, t.TransactionId, &row)
+	if err != nil {
+		return false, t.fail(err)
+	}
+
+	return isLocked, nil
+}
+
+func (t *SerializableSnapshotIsolation) TryLockTable(lockLevel LockLevel) error {
+	if err := ensureActive(t.TransactionId, t.status); err != nil {
+		return err
+	}
+
+	t.begin()
+
+	if err := t.locks.LockTable(t.TransactionId, lockLevel); err != nil {
+		return t.fail(err)
+	}
+
+	return nil
+}
+
+func (t *SerializableSnapshotIsolation) TryRollback() error {
+	if t.status != ActiveStatus && t.status != AbortedStatus {
+		return ensureActive(t.TransactionId, t.status)
+	}
+
+	t.rollback()
+	t.status = RolledBackStatus
+
+	return nil
+}
+
+func (t *SerializableSnapshotIsolation) rollback() {
+	for i := len(t.Operations) - 1; i >= 0; i-- {
+		op := t.Operations[i]
+
+		row := t.Table.Data[op.Key]
+		row.LatestUncommitted = op.FromValue
+		delete(row.UncommittedByTxId, t.TransactionId)
+		t.Table.Data[op.Key] = row
+	}
+
+	t.locks.UnlockAll(t.TransactionId)
+	t.Table.DeleteSnapshot(t.TransactionId)
+	t.Table.rwAntidependencies.Abort(t.TransactionId)
+	t.Operations = make([]Operation, 0)
+	t.keysTouched = make(map[Key]struct{})
+}
+
+// fail aborts the transaction after an operation was refused, it stays
+// aborted until rolled back.
+func (t *SerializableSnapshotIsolation) fail(err error) error {
+	t.rollback()
+	t.status = AbortedStatus
+
+	return err
+}
+
+func (t *SerializableSnapshotIsolation) TryCommit() error {
+	if err := ensureActive(t.TransactionId, t.status); err != nil {
+		return err
+	}
+
+	if err := t.locks.TakeWound(t.TransactionId); err != nil {
+		t.rollback()
+		t.status = RolledBackStatus
+
+		return err
+	}
+
+	for _, op := range t.Operations {
+		if t.Table.IsCommittedSinceSnapshot(op.Key, t.TransactionId) {
+			return t.abort(ErrConcurrentUpdate)
+		}
+	}
+
+	if _, isDangerous := t.Table.rwAntidependencies.DangerousStructure(t.TransactionId); isDangerous {
+		return t.abort(ErrSerializationFailure)
+	}
+
+	for _, op := range t.Operations {
+		t.Table.SetCommitted(op.Key, op.ToValue, t.TransactionId)
+	}
+
+	t.locks.UnlockAll(t.TransactionId)
+	t.Table.DeleteSnapshot(t.TransactionId)
+	t.Table.rwAntidependencies.Commit(t.TransactionId)
+	t.Operations = make([]Operation, 0)
+	t.keysTouched = make(map[Key]struct{})
+	t.status = CommittedStatus
+
+	return nil
+}
+
+func (t *SerializableSnapshotIsolation) abort(cause error) error {
+	t.rollback()
+	t.status = RolledBackStatus
+
+	return &SerializationFailureError{TxId: t.TransactionId, Cause: cause}
+}
+
+func (t *SerializableSnapshotIsolation) GetKeysTouched() []Key {
+	res := make([]Key, 0)
+
+	for key := range t.keysTouched {
+		res = append(res, key)
+	}
+
+	return res
+}
+
+func (t *SerializableSnapshotIsolation) GetLocks() *TransactionLocks {
+	return t.locks
+}
+
+func (t *SerializableSnapshotIsolation) Set(key Key, value Value) Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TrySet(key, value)
+	return t
+}
+
+func (t *SerializableSnapshotIsolation) Delete(key Key) Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TryDelete(key)
+	return t
+}
+
+func (t *SerializableSnapshotIsolation) Get(key Key) Value {
+	t.status = reopened(t.status)
+	value, err := t.TryGet(key)
+	t.err = err
+	return value
+}
+
+func (t *SerializableSnapshotIsolation) Scan(from Key, to Key) []KeyValue {
+	t.status = reopened(t.status)
+	rows, err := t.TryScan(from, to)
+	t.err = err
+	return rows
+}
+
+func (t *SerializableSnapshotIsolation) Lock(key Key) Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TryLock(key)
+	return t
+}
+
+func (t *SerializableSnapshotIsolation) LockWith(key Key, mode LockMode) Transaction {
+	t.status = reopened(t.status)
+	_, t.err = t.TryLockWith(key, mode)
+	return t
+}
+
+func (t *SerializableSnapshotIsolation) LockTable(lockLevel LockLevel) Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TryLockTable(lockLevel)
+	return t
+}
+
+func (t *SerializableSnapshotIsolation) Rollback() Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TryRollback()
+	return t
+}
+
+func (t *SerializableSnapshotIsolation) Commit() Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TryCommit()
+	return t
+}
+
+func (t *SerializableSnapshotIsolation) GetStatus() TransactionStatus {
+	return t.status
+}
+
+func (t *SerializableSnapshotIsolation) GetError() error {
+	return t.err
+}
@@ -6,22 +6,48 @@ type SnapshotIsolation struct {
 	Operations    []Operation
 	locks         *TransactionLocks
 	keysTouched   map[Key]struct{}
+	status        TransactionStatus
+	err           error
 }
 
 func NewSnapshotIsolation(transactionId TransactionId, table *Table) *SnapshotIsolation {
+	table.EnsureSnapshotTaken(transactionId)
+
 	return &SnapshotIsolation{
 		TransactionId: transactionId,
 		Table:         table,
 		Operations:    make([]Operation, 0),
-		locks:         NewTransactionLocks(),
+		locks:         NewTransactionLocks(table),
 		keysTouched:   make(map[Key]struct{}),
+		status:        ActiveStatus,
+		err:           nil,
 	}
 }
 
-func (t *SnapshotIsolation) Set(key Key, value Value) Transaction {
+func (t *SnapshotIsolation) TrySet(key Key, value Value) error {
+	if err := ensureActive(t.TransactionId, t.status); err != nil {
+		return err
+	}
+
 	t.Table.EnsureSnapshotTaken(t.TransactionId)
 
 	row, ok := t.Table.Data[key]
+	if !ok {
+		row = NewRow(key, TombstoneValue())
+	}
+
+	didILock, err := t.locks.Lock(ReadWrite, t.TransactionId, &row)
+	if err != nil {
+		return t.fail(err)
+	}
+	if didILock {
+		defer t.locks.Unlock(t.TransactionId, &row)
+	}
+
+	if ok {
+		row = t.Table.Data[key] // may have changed while waiting for its lock
+	}
+
 	prevValue, prevOk := row.UncommittedByTxId[t.TransactionId]
 
 	if !prevOk {
@@ -29,13 +55,7 @@ func (t *SnapshotIsolation) Set(key Key, value Value) Transaction {
 	}
 
 	if !ok {
-		row = NewRow(key, value)
-		prevValue = EmptyValue()
-	}
-
-	didILock := t.locks.Lock(ReadWrite, t.TransactionId, &row)
-	if didILock {
-		defer t.locks.Unlock(&row)
+		prevValue = TombstoneValue()
 	}
 
 	t.Operations = append(t.Operations, Operation{
@@ -48,74 +68,172 @@ func (t *SnapshotIsolation) Set(key Key, value Value) Transaction {
 	row.LatestUncommitted = value
 	row.UncommittedByTxId[t.TransactionId] = value
 	t.Table.Data[key] = row
-	return t
+
+	return nil
 }
 
-func (t *SnapshotIsolation) Get(key Key) Value {
+// TryDelete leaves a tombstone in place of the value, readers that can see
+// it find the key missing.
+func (t *SnapshotIsolation) TryDelete(key Key) error {
+	return t.TrySet(key, TombstoneValue())
+}
+
+func (t *SnapshotIsolation) TryGet(key Key) (Value, error) {
+	if err := ensureActive(t.TransactionId, t.status); err != nil {
+		return EmptyValue(), err
+	}
+
 	t.Table.EnsureSnapshotTaken(t.TransactionId)
 
 	row, ok := t.Table.Data[key]
 
 	if !ok {
-		return EmptyValue()
+		return EmptyValue(), nil
 	}
 
-	didILock := t.locks.Lock(Read, t.TransactionId, &row)
+	didILock, err := t.locks.Lock(Read, t.TransactionId, &row)
+	if err != nil {
+		return EmptyValue(), t.fail(err)
+	}
 	if didILock {
-		defer t.locks.Unlock(&row)
+		defer t.locks.Unlock(t.TransactionId, &row)
 	}
+	row = t.Table.Data[key]
 
 	t.keysTouched[key] = struct{}{}
 
 	if uncommitted, ok := row.UncommittedByTxId[t.TransactionId]; ok {
-		return uncommitted
+		return visibleValue(uncommitted), nil
 	}
 
 	val, _ := t.Table.GetCommitted(key, t.TransactionId)
-	return val
+	return visibleValue(val), nil
 }
 
-func (t *SnapshotIsolation) Lock(key Key) Transaction {
+// TryScan sees the rows of the range in the snapshot, rows inserted since it
+// was taken stay out of it.
+func (t *SnapshotIsolation) TryScan(from Key, to Key) ([]KeyValue, error) {
+	if err := ensureActive(t.TransactionId, t.status); err != nil {
+		return nil, err
+	}
+
+	t.Table.EnsureSnapshotTaken(t.TransactionId)
+
+	return scanRows(t.Table, from, to, t.TryGet)
+}
+
+func (t *SnapshotIsolation) TryLock(key Key) error {
+	_, err := t.TryLockWith(key, LockMode{Strength: ForUpdate, WaitPolicy: Wait})
+	return err
+}
+
+func (t *SnapshotIsolation) TryLockWith(key Key, mode LockMode) (bool, error) {
+	if err := ensureActive(t.TransactionId, t.status); err != nil {
+		return false, err
+	}
+
 	t.Table.EnsureSnapshotTaken(t.TransactionId)
 
 	row, ok := t.Table.Data[key]
 
 	if !ok {
-		return t
+		return false, nil
 	}
 
-	t.locks.Lock(ReadWrite, t.TransactionId, &row)
-	return t
+	isLocked, err := t.locks.LockWith(mode, t.TransactionId, &row)
+	if err != nil {
+		return false, t.fail(err)
+	}
+
+	return isLocked, nil
 }
 
-func (t *SnapshotIsolation) Rollback() Transaction {
+func (t *SnapshotIsolation) TryLockTable(lockLevel LockLevel) error {
+	if err := ensureActive(t.TransactionId, t.status); err != nil {
+		return err
+	}
+
+	t.Table.EnsureSnapshotTaken(t.TransactionId)
+
+	if err := t.locks.LockTable(t.TransactionId, lockLevel); err != nil {
+		return t.fail(err)
+	}
+
+	return nil
+}
+
+func (t *SnapshotIsolation) TryRollback() error {
+	if t.status != ActiveStatus && t.status != AbortedStatus {
+		return ensureActive(t.TransactionId, t.status)
+	}
+
+	t.rollback()
+	t.status = RolledBackStatus
+
+	return nil
+}
+
+func (t *SnapshotIsolation) rollback() {
 	for i := len(t.Operations) - 1; i >= 0; i-- {
 		op := t.Operations[i]
 
 		row := t.Table.Data[op.Key]
-		row.UncommittedByTxId[t.TransactionId] = op.FromValue
+		row.LatestUncommitted = op.FromValue
+		delete(row.UncommittedByTxId, t.TransactionId)
 		t.Table.Data[op.Key] = row
 	}
 
-	t.locks.UnlockAll()
+	t.locks.UnlockAll(t.TransactionId)
 	t.Table.DeleteSnapshot(t.TransactionId)
 	t.Operations = make([]Operation, 0)
 	t.keysTouched = make(map[Key]struct{})
+}
 
-	return t
+// fail aborts the transaction after an operation was refused, it stays
+// aborted until rolled back.
+func (t *SnapshotIsolation) fail(err error) error {
+	t.rollback()
+	t.status = AbortedStatus
+
+	return err
 }
 
-func (t *SnapshotIsolation) Commit() Transaction {
+func (t *SnapshotIsolation) TryCommit() error {
+	if err := ensureActive(t.TransactionId, t.status); err != nil {
+		return err
+	}
+
+	if err := t.locks.TakeWound(t.TransactionId); err != nil {
+		t.rollback()
+		t.status = RolledBackStatus
+
+		return err
+	}
+
+	for _, op := range t.Operations {
+		if t.Table.IsCommittedSinceSnapshot(op.Key, t.TransactionId) {
+			return t.abort(ErrConcurrentUpdate)
+		}
+	}
+
 	for _, op := range t.Operations {
 		t.Table.SetCommitted(op.Key, op.ToValue, t.TransactionId)
 	}
 
-	t.locks.UnlockAll()
+	t.locks.UnlockAll(t.TransactionId)
 	t.Table.DeleteSnapshot(t.TransactionId)
 	t.Operations = make([]Operation, 0)
 	t.keysTouched = make(map[Key]struct{})
+	t.status = CommittedStatus
 
-	return t
+	return nil
+}
+
+func (t *SnapshotIsolation) abort(cause error) error {
+	t.rollback()
+	t.status = RolledBackStatus
+
+	return &SerializationFailureError{TxId: t.TransactionId, Cause: cause}
 }
 
 func (t *SnapshotIsolation) GetKeysTouched() []Key {
@@ -131,3 +249,67 @@ func (t *SnapshotIsolation) GetKeysTouched() []Key {
 func (t *SnapshotIsolation) GetLocks() *TransactionLocks {
 	return t.locks
 }
+
+func (t *SnapshotIsolation) Set(key Key, value Value) Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TrySet(key, value)
+	return t
+}
+
+func (t *SnapshotIsolation) Delete(key Key) Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TryDelete(key)
+	return t
+}
+
+func (t *SnapshotIsolation) Get(key Key) Value {
+	t.status = reopened(t.status)
+	value, err := t.TryGet(key)
+	t.err = err
+	return value
+}
+
+func (t *SnapshotIsolation) Scan(from Key, to Key) []KeyValue {
+	t.status = reopened(t.status)
+	rows, err := t.TryScan(from, to)
+	t.err = err
+	return rows
+}
+
+func (t *SnapshotIsolation) Lock(key Key) Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TryLock(key)
+	return t
+}
+
+func (t *SnapshotIsolation) LockWith(key Key, mode LockMode) Transaction {
+	t.status = reopened(t.status)
+	_, t.err = t.TryLockWith(key, mode)
+	return t
+}
+
+func (t *SnapshotIsolation) LockTable(lockLevel LockLevel) Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TryLockTable(lockLevel)
+	return t
+}
+
+func (t *SnapshotIsolation) Rollback() Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TryRollback()
+	return t
+}
+
+func (t *SnapshotIsolation) Commit() Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TryCommit()
+	return t
+}
+
+func (t *SnapshotIsolation) GetStatus() TransactionStatus {
+	return t.status
+}
+
+func (t *SnapshotIsolation) GetError() error {
+	return t.err
+}
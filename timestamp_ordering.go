@@ -0,0 +1,424 @@
+package main
+
+// TimestampOrdering orders transactions by the timestamp they get when they
+// begin. A read of a row a younger transaction already wrote, or a write of a
+// row a younger transaction already read or wrote, arrives too late and
+// aborts the transaction with a TooLateError. With Table.ThomasWriteRule the
+// write of a row a younger transaction wrote is ignored instead.
+//
+// Reads of a row whose writer has not committed yet wait for its write lock,
+// so no transaction reads a value that might be rolled back.
+type TimestampOrdering struct {
+	TransactionId TransactionId
+	Table         *Table
+	Operations    []Operation
+	locks         *TransactionLocks
+	keysTouched   map[Key]struct{}
+	timestamp     int
+	// writeTs holds the write timestamps of the rows before this transaction
+	// first wrote them, rolling back restores them.
+	writeTs map[Key]int
+	status  TransactionStatus
+	err     error
+}
+
+func NewTimestampOrdering(transactionId TransactionId, table *Table) *TimestampOrdering {
+	t := &TimestampOrdering{
+		TransactionId: transactionId,
+		Table:         table,
+		Operations:    make([]Operation, 0),
+		locks:         NewTransactionLocks(table),
+		keysTouched:   make(map[Key]struct{}),
+		timestamp:     0,
+		writeTs:       make(map[Key]int),
+		status:        ActiveStatus,
+		err:           nil,
+	}
+
+	t.begin()
+
+	return t
+}
+
+// begin gives the transaction the next timestamp unless it already has one,
+// a transaction starting over after a commit or rollback gets a new one.
+func (t *TimestampOrdering) begin() {
+	if t.timestamp == 0 {
+		t.timestamp = t.Table.nextTimestamp()
+	}
+}
+
+func (t *TimestampOrdering) TrySet(key Key, value Value) error {
+	if err := ensureActive(t.TransactionId, t.status); err != nil {
+		return err
+	}
+
+	t.begin()
+
+	row, ok := t.Table.Data[key]
+	if !ok {
+		if scanTs := t.Table.scanTimestamp(key); scanTs > t.timestamp {
+			return t.fail(t.tooLate(WriteOperation, key, ScanOperation, scanTs))
+		}
+
+		row = NewRow(key, TombstoneValue())
+	}
+
+	if err := t.checkWrite(row); err != nil {
+		return t.fail(err)
+	}
+
+	didILock, err := t.locks.Lock(ReadWrite, t.TransactionId, &row)
+	if err != nil {
+		return t.fail(err)
+	}
+
+	if ok {
+		row = t.Table.Data[key] // may have changed while waiting for its lock
+	}
+
+	if err := t.checkWrite(row); err != nil {
+		return t.fail(err)
+	}
+
+	// Thomas' write rule, the younger write is there to stay
+	if row.WriteTs > t.timestamp {
+		if didILock {
+			t.locks.Unlock(t.TransactionId, &row)
+		}
+
+		return nil
+	}
+
+	prevValue, prevOk := row.UncommittedByTxId[t.TransactionId]
+
+	if !prevOk {
+		prevValue = row.Committed
+	}
+
+	if !ok {
+		prevValue = TombstoneValue()
+	}
+
+	t.Operations = append(t.Operations, Operation{
+		Key:       key,
+		FromValue: prevValue,
+		ToValue:   value,
+	})
+
+	if _, ok := t.writeTs[key]; !ok {
+		t.writeTs[key] = row.WriteTs
+	}
+
+	t.keysTouched[key] = struct{}{}
+	row.WriteTs = t.timestamp
+	row.LatestUncommitted = value
+	row.UncommittedByTxId[t.TransactionId] = value
+	t.Table.Data[key] = row
+
+	return nil
+}
+
+// checkWrite refuses a write arriving after a younger transaction read the
+// row, or wrote it unless Thomas' write rule applies.
+func (t *TimestampOrdering) checkWrite(row Row) error {
+	if row.ReadTs > t.timestamp {
+		return t.tooLate(WriteOperation, row.Key, ReadOperation, row.ReadTs)
+	}
+
+	if row.WriteTs > t.timestamp && !t.Table.ThomasWriteRule {
+		return t.tooLate(WriteOperation, row.Key, WriteOperation, row.WriteTs)
+	}
+
+	return nil
+}
+
+// TryDelete leaves a tombstone in place of the value, readers that can see
+// it find the key missing.
+func (t *TimestampOrdering) TryDelete(key Key) error {
+	return t.TrySet(key, TombstoneValue())
+}
+
+func (t *TimestampOrdering) TryGet(key Key) (Value, error) {
+	if err := ensureActive(t.TransactionId, t.status); err != nil {
+		return EmptyValue(), err
+	}
+
+	t.begin()
+
+	row, ok := t.Table.Data[key]
+
+	if !ok {
+		// nobody older may insert the key this transaction found missing
+		t.Table.recordScan(key, key, t.timestamp)
+		return EmptyValue(), nil
+	}
+
+	if uncommitted, ok := row.UncommittedByTxId[t.TransactionId]; ok {
+		return visibleValue(uncommitted), nil
+	}
+
+	if err := t.checkRead(row); err != nil {
+		return EmptyValue(), t.fail(err)
+	}
+
+	didILock, err := t.locks.Lock(Read, t.TransactionId, &row)
+	if err != nil {
+		return EmptyValue(), t.fail(err)
+	}
+	if didILock {
+		defer t.locks.Unlock(t.TransactionId, &row)
+	}
+	row = t.Table.Data[key]
+
+	if err := t.checkRead(row); err != nil {
+		return EmptyValue(), t.fail(err)
+	}
+
+	t.keysTouched[key] = struct{}{}
+	row.ReadTs = max(row.ReadTs, t.timestamp)
+	t.Table.Data[key] = row
+
+	return visibleValue(row.Committed), nil
+}
+
+// checkRead refuses a read arriving after a younger transaction wrote the
+// row.
+func (t *TimestampOrdering) checkRead(row Row) error {
+	if row.WriteTs > t.timestamp {
+		return t.tooLate(ReadOperation, row.Key, WriteOperation, row.WriteTs)
+	}
+
+	return nil
+}
+
+// TryScan stamps the range with the timestamp of the transaction, inserting
+// into it is then too late for older transactions.
+func (t *TimestampOrdering) TryScan(from Key, to Key) ([]KeyValue, error) {
+	if err := ensureActive(t.TransactionId, t.status); err != nil {
+		return nil, err
+	}
+
+	t.begin()
+	t.Table.recordScan(from, to, t.timestamp)
+
+	return scanRows(t.Table, from, to, t.TryGet)
+}
+
+func (t *TimestampOrdering) TryLock(key Key) error {
+	_, err := t.TryLockWith(key, LockMode{Strength: ForUpdate, WaitPolicy: Wait})
+	return err
+}
+
+func (t *TimestampOrdering) TryLockWith(key Key, mode LockMode) (bool, error) {
+	if err := ensureActive(t.TransactionId, t.status); err != nil {
+		return false, err
+	}
+
+	t.begin()
+
+	row, ok := t.Table.Data[key]
+
+	if !ok {
+		return false, nil
+	}
+
+	isLocked, err := t.locks.LockWith(mode, t.TransactionId, &row)
+	if err != nil {
+		return false, t.fail(err)
+	}
+
+	return isLocked, nil
+}
+
+func (t *TimestampOrdering) TryLockTable(lockLevel LockLevel) error {
+	if err := ensureActive(t.TransactionId, t.status); err != nil {
+		return err
+	}
+
+	t.begin()
+
+	if err := t.locks.LockTable(t.TransactionId, lockLevel); err != nil {
+		return t.fail(err)
+	}
+
+	return nil
+}
+
+func (t *TimestampOrdering) tooLate(operationType OperationType, key Key, conflictType OperationType, conflictTs int) error {
+	return &TooLateError{
+		TxId:          t.TransactionId,
+		Timestamp:     t.timestamp,
+		OperationType: operationType,
+		Key:           key,
+		ConflictType:  conflictType,
+		ConflictTs:    conflictTs,
+	}
+}
+
+func (t *TimestampOrdering) TryRollback() error {
+	if t.status != ActiveStatus && t.status != AbortedStatus {
+		return ensureActive(t.TransactionId, t.status)
+	}
+
+	t.rollback()
+	t.status = RolledBackStatus
+
+	return nil
+}
+
+func (t *TimestampOrdering) rollback() {
+	for i := len(t.Operations) - 1; i >= 0; i-- {
+		op := t.Operations[i]
+
+		row := t.Table.Data[op.Key]
+		row.LatestUncommitted = op.FromValue
+		row.WriteTs = t.writeTs[op.Key]
+		delete(row.UncommittedByTxId, t.TransactionId)
+		t.Table.Data[op.Key] = row
+	}
+
+	t.locks.UnlockAll(t.TransactionId)
+	t.Operations = make([]Operation, 0)
+	t.keysTouched = make(map[Key]struct{})
+	t.writeTs = make(map[Key]int)
+	t.timestamp = 0
+}
+
+// fail aborts the transaction after an operation was refused, it stays
+// aborted until rolled back.
+func (t *TimestampOrdering) fail(err error) error {
+	t.rollback()
+	t.status = AbortedStatus
+
+	return err
+}
+
+func (t *TimestampOrdering) TryCommit() error {
+	if err := ensureActive(t.TransactionId, t.status); err != nil {
+		return err
+	}
+
+	if err := t.locks.TakeWound(t.TransactionId); err != nil {
+		t.rollback()
+		t.status = RolledBackStatus
+
+		return err
+	}
+
+	for _, op := range t.Operations {
+		t.Table.SetCommitted(op.Key, op.ToValue, t.TransactionId)
+	}
+
+	t.locks.UnlockAll(t.TransactionId)
+	t.Operations = make([]Operation, 0)
+	t.keysTouched = make(map[Key]struct{})
+	t.writeTs = make(map[Key]int)
+	t.timestamp = 0
+	t.status = CommittedStatus
+
+	return nil
+}
+
+func (t *TimestampOrdering) GetKeysTouched() []Key {
+	res := make([]Key, 0)
+
+	for key := range t.keysTouched {
+		res = append(res, key)
+	}
+
+	return res
+}
+
+func (t *TimestampOrdering) GetLocks() *TransactionLocks {
+	return t.locks
+}
+
+func (t *TimestampOrdering) Set(key Key, value Value) Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TrySet(key, value)
+	return t
+}
+
+func (t *TimestampOrdering) Delete(key Key) Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TryDelete(key)
+	return t
+}
+
+func (t *TimestampOrdering) Get(key Key) Value {
+	t.status = reopened(t.status)
+	value, err := t.TryGet(key)
+	t.err = err
+	return value
+}
+
+func (t *TimestampOrdering) Scan(from Key, to Key) []KeyValue {
+	t.status = reopened(t.status)
+	rows, err := t.TryScan(from, to)
+	t.err = err
+	return rows
+}
+
+func (t *TimestampOrdering) Lock(key Key) Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TryLock(key)
+	return t
+}
+
+func (t *TimestampOrdering) LockWith(key Key, mode LockMode) Transaction {
+	t.status = reopened(t.status)
+	_, t.err = t.TryLockWith(key, mode)
+	return t
+}
+
+func (t *TimestampOrdering) LockTable(lockLevel LockLevel) Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TryLockTable(lockLevel)
+	return t
+}
+
+func (t *TimestampOrdering) Rollback() Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TryRollback()
+	return t
+}
+
+func (t *TimestampOrdering) Commit() Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TryCommit()
+	return t
+}
+
+func (t *TimestampOrdering) GetStatus() TransactionStatus {
+	return t.status
+}
+
+func (t *TimestampOrdering) GetError() error {
+	return t.err
+}
+
+func (t *Table) nextTimestamp() int {
+	t.timestamps++
+	return t.timestamps
+}
+
+// recordScan raises the read timestamp of a range to ts.
+func (t *Table) recordScan(from Key, to Key, ts int) {
+	keyRange := keyRange{from: from, to: to}
+	t.rangeReadTs[keyRange] = max(t.rangeReadTs[keyRange], ts)
+}
+
+// scanTimestamp returns the timestamp of the youngest scan of a range key
+// falls into.
+func (t *Table) scanTimestamp(key Key) int {
+	res := 0
+
+	for keyRange, ts := range t.rangeReadTs {
+		if keyRange.contains(key) {
+			res = max(res, ts)
+		}
+	}
+
+	return res
+}
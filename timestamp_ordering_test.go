@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTimestampOrderingAbortsTooLateRead(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "50")
+	table.Data["y"] = NewRow("y", "50")
+
+	events := []Event{
+		NewRead("t1", TimestampOrderingLevel, "x"),
+		NewWrite("t2", TimestampOrderingLevel, "x", "40"),
+		NewWrite("t2", TimestampOrderingLevel, "y", "60"),
+		NewCommit("t2", TimestampOrderingLevel),
+		NewRead("t1", TimestampOrderingLevel, "y"),
+	}
+
+	mermaid, err := PlayEvents(events, &table)
+	if err != nil {
+		t.Fatalf("expected PlayEvents to succeed, got error: %v", err)
+	}
+
+	var tooLateErr *TooLateError
+	if !errors.As(events[4].Err, &tooLateErr) {
+		t.Fatalf("got %v, want too late error", events[4].Err)
+	}
+
+	want := "y -x t1: t1 with timestamp 1 is too late to read y, written at timestamp 2"
+	if !strings.Contains(mermaid, want) {
+		t.Errorf("expected %q in\n%v", want, mermaid)
+	}
+}
+
+func TestTimestampOrderingAbortsTooLateWrite(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "A")
+
+	older := NewTimestampOrdering("1", &table)
+	olderInserting := NewTimestampOrdering("2", &table)
+	NewTimestampOrdering("3", &table).Scan("a", "z")
+
+	want := "1 with timestamp 1 is too late to write x, read at timestamp 3"
+	if err := older.TrySet("x", "B"); err == nil || err.Error() != want {
+		t.Errorf("got %v, want %v", err, want)
+	}
+
+	want = "2 with timestamp 2 is too late to insert y, scanned at timestamp 3"
+	if err := olderInserting.TrySet("y", "B"); err == nil || err.Error() != want {
+		t.Errorf("got %v, want %v", err, want)
+	}
+
+	if status := older.GetStatus(); status != AbortedStatus {
+		t.Errorf("got %v, want %v", status, AbortedStatus)
+	}
+}
+
+func TestThomasWriteRule(t *testing.T) {
+	tests := []struct {
+		thomasWriteRule bool
+		wantErr         string
+		want            Value
+	}{
+		{thomasWriteRule: false, wantErr: "t1 with timestamp 1 is too late to write x, written at timestamp 2", want: "2"},
+		{thomasWriteRule: true, wantErr: "", want: "2"},
+	}
+
+	for _, tt := range tests {
+		table := NewTable()
+		table.Data["x"] = NewRow("x", "0")
+		table.ThomasWriteRule = tt.thomasWriteRule
+
+		events := []Event{
+			NewRead("t1", TimestampOrderingLevel, "y"),
+			NewWrite("t2", TimestampOrderingLevel, "x", "2"),
+			NewCommit("t2", TimestampOrderingLevel),
+			NewWrite("t1", TimestampOrderingLevel, "x", "1"),
+			NewCommit("t1", TimestampOrderingLevel),
+		}
+
+		if _, err := PlayEvents(events, &table); err != nil {
+			t.Fatalf("expected PlayEvents to succeed, got error: %v", err)
+		}
+
+		gotErr := ""
+		if events[3].Err != nil {
+			gotErr = events[3].Err.Error()
+		}
+
+		if gotErr != tt.wantErr {
+			t.Errorf("thomas write rule %v: got %v, want %v", tt.thomasWriteRule, gotErr, tt.wantErr)
+		}
+
+		if got := table.Data["x"].Committed; got != tt.want {
+			t.Errorf("thomas write rule %v: got %v, want %v", tt.thomasWriteRule, got, tt.want)
+		}
+	}
+}
+
+func TestThomasWriteRuleWaitsForYoungerWriterToFinish(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "0")
+	table.ThomasWriteRule = true
+
+	events := []Event{
+		NewRead("t1", TimestampOrderingLevel, "y"),
+		NewWrite("t2", TimestampOrderingLevel, "x", "2"),
+		NewWrite("t1", TimestampOrderingLevel, "x", "1"),
+		NewRollback("t2", TimestampOrderingLevel),
+		NewCommit("t1", TimestampOrderingLevel),
+	}
+
+	if _, err := PlayEvents(events, &table); err != nil {
+		t.Fatalf("expected PlayEvents to succeed, got error: %v", err)
+	}
+
+	if got := table.Data["x"].Committed; got != "1" {
+		t.Errorf("got %v, want %v", got, "1")
+	}
+}
+
+func TestTimestampOrderingReadWaitsForUncommittedWrite(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "0")
+	table.History = NewHistory()
+
+	events := []Event{
+		NewWrite("t1", TimestampOrderingLevel, "x", "1"),
+		NewRead("t2", TimestampOrderingLevel, "x"),
+		NewWrite("t1", TimestampOrderingLevel, "x", "2"),
+		NewCommit("t1", TimestampOrderingLevel),
+		NewCommit("t2", TimestampOrderingLevel),
+	}
+
+	if _, err := PlayEvents(events, &table); err != nil {
+		t.Fatalf("expected PlayEvents to succeed, got error: %v", err)
+	}
+
+	want := "t1:w(x)=1 t1:w(x)=2 t1:c t2:r(x)=2 t2:c"
+	if got := table.History.String(); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
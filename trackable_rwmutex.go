@@ -1,68 +1,245 @@
 package main
 
 import (
+	"fmt"
+	"slices"
+	"strings"
 	"sync"
 )
 
+// TrackableRWMutex is the lock of a single row, a range or the whole table. It
+// only records its queue of lock requests, the granted group holding it and
+// the waiting list in the order the requests will be granted. The waiting
+// itself is coordinated by LockManager.
 type TrackableRWMutex struct {
-	mu      sync.RWMutex
 	stateMu sync.Mutex
-	readers int
-	writer  bool
-	owner   TransactionId
+	granted []*lockRequest
+	waiters []*lockRequest
 }
 
 func NewTrackableRWMutex() *TrackableRWMutex {
 	return &TrackableRWMutex{
-		mu:      sync.RWMutex{},
 		stateMu: sync.Mutex{},
-		readers: 0,
-		writer:  false,
-		owner:   EmptyTransactionId(),
+		granted: make([]*lockRequest, 0),
+		waiters: make([]*lockRequest, 0),
 	}
 }
 
-func (t *TrackableRWMutex) LockFor(txId TransactionId) {
-	t.mu.Lock()
-	t.stateMu.Lock()
-	t.writer = true
-	t.owner = txId
-	t.stateMu.Unlock()
+// isConflicting tells whether two transactions cannot hold the two lock
+// levels at once, following the compatibility matrix of multiple granularity
+// locking.
+//
+//	     IS  IX  S   SIX X
+//	IS   ok  ok  ok  ok  -
+//	IX   ok  ok  -   -   -
+//	S    ok  -   ok  -   -
+//	SIX  ok  -   -   -   -
+//	X    -   -   -   -   -
+func isConflicting(lockLevel LockLevel, otherLockLevel LockLevel) bool {
+	switch {
+	case lockLevel == EmptyLockLevel || otherLockLevel == EmptyLockLevel:
+		return false
+	case lockLevel == ReadWrite || otherLockLevel == ReadWrite:
+		return true
+	case lockLevel == IntentionShared || otherLockLevel == IntentionShared:
+		return false
+	case lockLevel == SharedIntentionExclusive || otherLockLevel == SharedIntentionExclusive:
+		return true
+	default:
+		return lockLevel != otherLockLevel
+	}
+}
+
+// supremum returns the weakest lock level at least as strong as both, the one
+// a transaction holding lockLevel and asking for otherLockLevel converts to.
+func supremum(lockLevel LockLevel, otherLockLevel LockLevel) LockLevel {
+	switch {
+	case lockLevel == otherLockLevel || otherLockLevel == EmptyLockLevel:
+		return lockLevel
+	case lockLevel == EmptyLockLevel:
+		return otherLockLevel
+	case lockLevel == ReadWrite || otherLockLevel == ReadWrite:
+		return ReadWrite
+	case lockLevel == SharedIntentionExclusive || otherLockLevel == SharedIntentionExclusive:
+		return SharedIntentionExclusive
+	case lockLevel == IntentionShared:
+		return otherLockLevel
+	case otherLockLevel == IntentionShared:
+		return lockLevel
+	default:
+		return SharedIntentionExclusive
+	}
+}
+
+// covers tells whether holding lockLevel already grants otherLockLevel.
+func covers(lockLevel LockLevel, otherLockLevel LockLevel) bool {
+	return supremum(lockLevel, otherLockLevel) == lockLevel
+}
+
+// blockers returns the transactions txId has to wait for to get lockLevel:
+// the holders it conflicts with and, requests being granted in order, the
+// conflicting requests queued before its own. A request that is not queued
+// yet comes after every queued one, so readers cannot overtake a waiting
+// writer, unless it converts a lock txId holds, conversions only come after
+// the other conversions.
+func (t *TrackableRWMutex) blockers(txId TransactionId, lockLevel LockLevel) []TransactionId {
+	res := make([]TransactionId, 0)
+	isConverting := t.isHeldBy(txId)
+
+	for _, request := range t.granted {
+		if request.txId != txId && isConflicting(request.lockLevel, lockLevel) {
+			res = append(res, request.txId)
+		}
+	}
+
+	for _, request := range t.waiters {
+		if request.txId == txId {
+			break
+		}
+
+		if isConverting && !request.isConversion {
+			continue
+		}
+
+		if isConflicting(request.lockLevel, lockLevel) {
+			res = append(res, request.txId)
+		}
+	}
+
+	return res
+}
+
+func (t *TrackableRWMutex) isHeldBy(txId TransactionId) bool {
+	for _, request := range t.granted {
+		if request.txId == txId {
+			return true
+		}
+	}
+
+	return false
 }
 
-func (t *TrackableRWMutex) Unlock() {
+// enqueue adds request to the waiting list, after the other conversions if
+// it is one and at the end otherwise.
+func (t *TrackableRWMutex) enqueue(request *lockRequest) {
 	t.stateMu.Lock()
-	t.writer = false
-	t.owner = EmptyTransactionId()
-	t.stateMu.Unlock()
-	t.mu.Unlock()
+	defer t.stateMu.Unlock()
+
+	if !request.isConversion {
+		t.waiters = append(t.waiters, request)
+		return
+	}
+
+	i := 0
+	for i < len(t.waiters) && t.waiters[i].isConversion {
+		i++
+	}
+
+	t.waiters = slices.Insert(t.waiters, i, request)
 }
 
-func (t *TrackableRWMutex) RLock() {
-	t.mu.RLock()
+// grant adds request to the granted group. A conversion replaces the lock its
+// transaction held with one at least as strong as both.
+func (t *TrackableRWMutex) grant(request *lockRequest) {
 	t.stateMu.Lock()
-	t.readers++
-	t.stateMu.Unlock()
+	defer t.stateMu.Unlock()
+
+	for i, granted := range t.granted {
+		if granted.txId == request.txId {
+			request.lockLevel = supremum(granted.lockLevel, request.lockLevel)
+			t.granted = slices.Delete(t.granted, i, i+1)
+			break
+		}
+	}
+
+	t.granted = append(t.granted, request)
 }
 
-func (t *TrackableRWMutex) RUnlock() {
+func (t *TrackableRWMutex) release(txId TransactionId, lockLevel LockLevel) {
 	t.stateMu.Lock()
-	t.readers--
-	t.stateMu.Unlock()
-	t.mu.RUnlock()
+	defer t.stateMu.Unlock()
+
+	for i, request := range t.granted {
+		if request.txId == txId && request.lockLevel == lockLevel {
+			t.granted = append(t.granted[:i], t.granted[i+1:]...)
+			return
+		}
+	}
 }
 
 func (t *TrackableRWMutex) IsBlocked(txId TransactionId) bool {
 	t.stateMu.Lock()
 	defer t.stateMu.Unlock()
 
-	isReadLocked := t.readers > 0
-	if isReadLocked {
-		return true
+	return len(t.blockers(txId, ReadWrite)) > 0
+}
+
+// Queue returns the granted group and the waiting list of the lock.
+func (t *TrackableRWMutex) Queue() LockQueue {
+	t.stateMu.Lock()
+	defer t.stateMu.Unlock()
+
+	return LockQueue{
+		Granted: toQueuedRequests(t.granted),
+		Waiting: toQueuedRequests(t.waiters),
+	}
+}
+
+// QueuedRequest is a lock request as seen from outside the lock manager.
+type QueuedRequest struct {
+	TxId      TransactionId
+	LockLevel LockLevel
+}
+
+func (r QueuedRequest) String() string {
+	return fmt.Sprintf("%v (%v)", r.TxId, r.LockLevel)
+}
+
+func toQueuedRequests(requests []*lockRequest) []QueuedRequest {
+	res := make([]QueuedRequest, 0)
+
+	for _, request := range requests {
+		res = append(res, QueuedRequest{TxId: request.txId, LockLevel: request.lockLevel})
+	}
+
+	return res
+}
+
+// LockQueue is the state of a lock, the requests holding it in the order they
+// were granted and the ones waiting for it in the order they will be.
+type LockQueue struct {
+	Granted []QueuedRequest
+	Waiting []QueuedRequest
+}
+
+func (q LockQueue) String() string {
+	return fmt.Sprintf("granted %v, waiting %v", joinQueuedRequests(q.Granted), joinQueuedRequests(q.Waiting))
+}
+
+func joinQueuedRequests(requests []QueuedRequest) string {
+	if len(requests) == 0 {
+		return "none"
+	}
+
+	res := make([]string, 0)
+	for _, request := range requests {
+		res = append(res, request.String())
 	}
 
-	isWriteLocked := bool(t.writer)
-	wasLockedByMe := (t.owner == txId || t.owner == EmptyTransactionId())
+	return strings.Join(res, ", ")
+}
+
+// TableLockQueue returns the queue of the lock of the whole table.
+func (t *Table) TableLockQueue() LockQueue {
+	return t.lock.Queue()
+}
+
+// LockQueue returns the queue of the lock of the row of key.
+func (t *Table) LockQueue(key Key) (LockQueue, bool) {
+	row, ok := t.Data[key]
+	if !ok {
+		return LockQueue{}, false
+	}
 
-	return isWriteLocked && !wasLockedByMe
+	return row.Lock.Queue(), true
 }
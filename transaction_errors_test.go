@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestOperationsAfterCommitFail(t *testing.T) {
+	table := NewTable()
+	transactions := []Transaction{
+		NewReadUncommitted("1", &table),
+		NewReadCommitted("1", &table),
+		NewSnapshotIsolation("1", &table),
+		NewTwoPhaseLocking("1", &table),
+		NewSerializableSnapshotIsolation("1", &table),
+	}
+
+	for _, tx := range transactions {
+		table = NewTable()
+
+		if err := tx.TrySet("x", "A"); err != nil {
+			t.Errorf("got %v, want set to succeed", err)
+		}
+
+		if err := tx.TryCommit(); err != nil {
+			t.Errorf("got %v, want commit to succeed", err)
+		}
+
+		var finishedErr *TransactionFinishedError
+
+		if _, err := tx.TryGet("x"); !errors.As(err, &finishedErr) || finishedErr.Status != CommittedStatus {
+			t.Errorf("got %v, want transaction finished error", err)
+		}
+
+		if err := tx.TryRollback(); !errors.As(err, &finishedErr) {
+			t.Errorf("got %v, want transaction finished error", err)
+		}
+
+		value := tx.Get("x")
+		if value != "A" || tx.GetError() != nil {
+			t.Errorf("got %v, %v, want chaining to start a new transaction", value, tx.GetError())
+		}
+	}
+}
+
+func TestSerializationFailureRollsBack(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "A")
+
+	t1 := NewSnapshotIsolation("1", &table)
+	t2 := NewSnapshotIsolation("2", &table)
+
+	t1.Set("x", "B")
+	t2.Set("x", "C").Commit()
+
+	var serializationErr *SerializationFailureError
+	if err := t1.TryCommit(); !errors.As(err, &serializationErr) || serializationErr.TxId != "1" {
+		t.Errorf("got %v, want serialization failure", err)
+	}
+
+	if t1.GetStatus() != RolledBackStatus {
+		t.Errorf("got %v, want %v", t1.GetStatus(), RolledBackStatus)
+	}
+}
+
+func TestPlayEventsSurfacesErrorsPerEvent(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "1")
+
+	events := []Event{
+		NewWrite("t1", ReadCommittedLevel, "x", "2"),
+		NewCommit("t1", ReadCommittedLevel),
+		NewRead("t1", ReadCommittedLevel, "x"),
+	}
+
+	if _, err := PlayEvents(events, &table); err != nil {
+		t.Errorf("expected PlayEvents to succeed, got error: %v", err)
+	}
+
+	for _, event := range events[:2] {
+		if event.Err != nil {
+			t.Errorf("got %v, want no error", event.Err)
+		}
+	}
+
+	var finishedErr *TransactionFinishedError
+	if !errors.As(events[2].Err, &finishedErr) {
+		t.Errorf("got %v, want transaction finished error", events[2].Err)
+	}
+}
@@ -1,39 +1,122 @@
 package main
 
+import (
+	"cmp"
+	"fmt"
+	"slices"
+)
+
+// TwoPhaseLockingVariant tells which locks a two phase locking transaction
+// releases once it starts shrinking, the others are held until it finishes.
+type TwoPhaseLockingVariant int
+
+const (
+	// StrictTwoPhaseLocking releases the read locks, writes stay invisible to
+	// other transactions until they are committed.
+	StrictTwoPhaseLocking TwoPhaseLockingVariant = iota
+	// NonStrictTwoPhaseLocking releases every lock, other transactions may
+	// then read uncommitted writes and have to abort if those roll back.
+	NonStrictTwoPhaseLocking
+	// RigorousTwoPhaseLocking releases no lock before the transaction
+	// finishes.
+	RigorousTwoPhaseLocking
+)
+
+func (v TwoPhaseLockingVariant) String() string {
+	switch v {
+	case StrictTwoPhaseLocking:
+		return "strict"
+	case NonStrictTwoPhaseLocking:
+		return "non-strict"
+	case RigorousTwoPhaseLocking:
+		return "rigorous"
+	default:
+		return fmt.Sprintf("TwoPhaseLockingVariant(%d)", int(v))
+	}
+}
+
+// TwoPhaseLocking takes a lock before every read and write. Until it shrinks
+// it holds every lock until it finishes, after that it may not take any new
+// lock and releases the locks its Table.TwoPhaseLockingVariant allows.
+//
+// Reading or overwriting the uncommitted write of a transaction that released
+// its write lock makes the reader depend on the writer, it cannot commit
+// before the writer and is aborted with a CascadingAbortError if the writer
+// rolls back.
 type TwoPhaseLocking struct {
 	TransactionId TransactionId
 	Table         *Table
 	Operations    []Operation
 	locks         *TransactionLocks
 	keysTouched   map[Key]struct{}
+	isShrinking   bool
+	// dependencies holds the writers whose uncommitted writes the transaction
+	// read or overwrote, along with the key of one of them.
+	dependencies   map[TransactionId]Key
+	cascadingAbort error
+	status         TransactionStatus
+	err            error
 }
 
 func NewTwoPhaseLocking(transactionId TransactionId, table *Table) *TwoPhaseLocking {
 	return &TwoPhaseLocking{
-		TransactionId: transactionId,
-		Table:         table,
-		Operations:    make([]Operation, 0),
-		locks:         NewTransactionLocks(),
-		keysTouched:   make(map[Key]struct{}),
+		TransactionId:  transactionId,
+		Table:          table,
+		Operations:     make([]Operation, 0),
+		locks:          NewTransactionLocks(table),
+		keysTouched:    make(map[Key]struct{}),
+		isShrinking:    false,
+		dependencies:   make(map[TransactionId]Key),
+		cascadingAbort: nil,
+		status:         ActiveStatus,
+		err:            nil,
 	}
 }
 
-func (t *TwoPhaseLocking) Set(key Key, value Value) Transaction {
-	t.Table.EnsureSnapshotTaken(t.TransactionId)
+func (t *TwoPhaseLocking) TrySet(key Key, value Value) error {
+	if err := t.ensureActive(); err != nil {
+		return err
+	}
+
+	if err := t.ensureGrowing(ReadWrite, key); err != nil {
+		return err
+	}
 
 	row, ok := t.Table.Data[key]
+	if !ok {
+		if err := t.locks.LockInsert(t.TransactionId, key); err != nil {
+			return t.fail(err)
+		}
+
+		row, ok = t.Table.Data[key] // may have been inserted while waiting
+	}
+
+	if !ok {
+		row = NewRow(key, TombstoneValue())
+	}
+
+	if _, err := t.locks.Lock(ReadWrite, t.TransactionId, &row); err != nil {
+		return t.fail(err)
+	}
+
+	if ok {
+		row = t.Table.Data[key] // may have changed while waiting for its lock
+	}
+
 	prevValue, prevOk := row.UncommittedByTxId[t.TransactionId]
 
 	if !prevOk {
 		prevValue = row.Committed
 	}
 
-	if !ok {
-		row = NewRow(key, value)
-		prevValue = EmptyValue()
+	if writers := t.uncommittedWriters(row); !prevOk && len(writers) > 0 {
+		t.dependOn(writers, key)
+		prevValue = row.LatestUncommitted
 	}
 
-	t.locks.Lock(ReadWrite, t.TransactionId, &row)
+	if !ok {
+		prevValue = TombstoneValue()
+	}
 
 	t.Operations = append(t.Operations, Operation{
 		Key:       key,
@@ -45,70 +128,288 @@ func (t *TwoPhaseLocking) Set(key Key, value Value) Transaction {
 	row.LatestUncommitted = value
 	row.UncommittedByTxId[t.TransactionId] = value
 	t.Table.Data[key] = row
-	return t
+
+	return nil
 }
 
-func (t *TwoPhaseLocking) Get(key Key) Value {
-	t.Table.EnsureSnapshotTaken(t.TransactionId)
+// TryDelete leaves a tombstone in place of the value, readers that can see
+// it find the key missing.
+func (t *TwoPhaseLocking) TryDelete(key Key) error {
+	return t.TrySet(key, TombstoneValue())
+}
+
+func (t *TwoPhaseLocking) TryGet(key Key) (Value, error) {
+	if err := t.ensureActive(); err != nil {
+		return EmptyValue(), err
+	}
 
 	row, ok := t.Table.Data[key]
 
 	if !ok {
-		return EmptyValue()
+		return EmptyValue(), nil
 	}
 
-	t.locks.Lock(Read, t.TransactionId, &row)
+	if err := t.ensureGrowing(Read, key); err != nil {
+		return EmptyValue(), err
+	}
+
+	if _, err := t.locks.Lock(Read, t.TransactionId, &row); err != nil {
+		return EmptyValue(), t.fail(err)
+	}
+	row = t.Table.Data[key]
 	t.keysTouched[key] = struct{}{}
 
 	if uncommitted, ok := row.UncommittedByTxId[t.TransactionId]; ok {
-		return uncommitted
+		return visibleValue(uncommitted), nil
+	}
+
+	// only writers that already released their write lock are left
+	if writers := t.uncommittedWriters(row); len(writers) > 0 {
+		t.dependOn(writers, key)
+		return visibleValue(row.LatestUncommitted), nil
 	}
 
-	val, _ := t.Table.GetCommitted(key, t.TransactionId)
-	return val
+	// holding the read lock, the latest committed value cannot change until
+	// the transaction finishes
+	return visibleValue(row.Committed), nil
 }
 
-func (t *TwoPhaseLocking) Lock(key Key) Transaction {
-	t.Table.EnsureSnapshotTaken(t.TransactionId)
+// TryScan locks the range before read locking the rows it finds in it, other
+// transactions cannot insert into the range until this one finishes, so
+// scanning it again never finds a phantom.
+func (t *TwoPhaseLocking) TryScan(from Key, to Key) ([]KeyValue, error) {
+	if err := t.ensureActive(); err != nil {
+		return nil, err
+	}
+
+	if t.isShrinking && !t.locks.HoldsRange(from, to) {
+		return nil, ErrLockAfterShrinking
+	}
+
+	if err := t.locks.LockRange(t.TransactionId, from, to); err != nil {
+		return nil, t.fail(err)
+	}
+
+	return scanRows(t.Table, from, to, t.TryGet)
+}
+
+func (t *TwoPhaseLocking) TryLock(key Key) error {
+	_, err := t.TryLockWith(key, LockMode{Strength: ForUpdate, WaitPolicy: Wait})
+	return err
+}
+
+func (t *TwoPhaseLocking) TryLockWith(key Key, mode LockMode) (bool, error) {
+	if err := t.ensureActive(); err != nil {
+		return false, err
+	}
 
 	row, ok := t.Table.Data[key]
 
 	if !ok {
-		return t
+		return false, nil
 	}
 
-	t.locks.Lock(ReadWrite, t.TransactionId, &row)
-	return t
+	if err := t.ensureGrowing(mode.lockLevel(), key); err != nil {
+		return false, err
+	}
+
+	isLocked, err := t.locks.LockWith(mode, t.TransactionId, &row)
+	if err != nil {
+		return false, t.fail(err)
+	}
+
+	return isLocked, nil
 }
 
-func (t *TwoPhaseLocking) Rollback() Transaction {
+func (t *TwoPhaseLocking) TryLockTable(lockLevel LockLevel) error {
+	if err := t.ensureActive(); err != nil {
+		return err
+	}
+
+	if t.isShrinking && !t.locks.HoldsTable(lockLevel) {
+		return ErrLockAfterShrinking
+	}
+
+	if err := t.locks.LockTable(t.TransactionId, lockLevel); err != nil {
+		return t.fail(err)
+	}
+
+	return nil
+}
+
+// TryShrink starts the shrinking phase, the transaction releases the locks
+// its variant allows and may not take any new lock until it finishes.
+func (t *TwoPhaseLocking) TryShrink() error {
+	if err := t.ensureActive(); err != nil {
+		return err
+	}
+
+	t.isShrinking = true
+
+	switch t.Table.TwoPhaseLockingVariant {
+	case StrictTwoPhaseLocking:
+		t.locks.UnlockReads(t.TransactionId)
+	case NonStrictTwoPhaseLocking:
+		t.locks.UnlockReads(t.TransactionId)
+		t.locks.UnlockWrites(t.TransactionId)
+	}
+
+	return nil
+}
+
+// ensureGrowing refuses to take a new lock once the transaction started
+// shrinking, it may only use the locks it still holds.
+func (t *TwoPhaseLocking) ensureGrowing(lockLevel LockLevel, key Key) error {
+	if t.isShrinking && !t.locks.Holds(lockLevel, key) {
+		return ErrLockAfterShrinking
+	}
+
+	return nil
+}
+
+// ensureActive tells the cause of a cascading abort, which happens while the
+// transaction is not running any operation.
+func (t *TwoPhaseLocking) ensureActive() error {
+	if t.status == AbortedStatus && t.cascadingAbort != nil {
+		return t.cascadingAbort
+	}
+
+	return ensureActive(t.TransactionId, t.status)
+}
+
+// uncommittedWriters returns the other transactions with an uncommitted write
+// of row, in order.
+func (t *TwoPhaseLocking) uncommittedWriters(row Row) []TransactionId {
+	res := make([]TransactionId, 0)
+
+	for txId := range row.UncommittedByTxId {
+		if txId != t.TransactionId {
+			res = append(res, txId)
+		}
+	}
+
+	slices.Sort(res)
+
+	return res
+}
+
+func (t *TwoPhaseLocking) dependOn(writers []TransactionId, key Key) {
+	for _, writer := range writers {
+		if _, ok := t.Table.dependents[writer]; !ok {
+			t.Table.dependents[writer] = make(map[*TwoPhaseLocking]Key)
+		}
+
+		t.Table.dependents[writer][t] = key
+		t.dependencies[writer] = key
+	}
+}
+
+// cascade aborts the transaction because writer, whose uncommitted write of
+// key it depends on, rolled back.
+func (t *TwoPhaseLocking) cascade(writer TransactionId, key Key) {
+	if t.status != ActiveStatus {
+		return
+	}
+
+	t.cascadingAbort = &CascadingAbortError{TxId: t.TransactionId, Writer: writer, Key: key}
+	t.err = t.fail(t.cascadingAbort)
+}
+
+func (t *TwoPhaseLocking) TryRollback() error {
+	if t.status != ActiveStatus && t.status != AbortedStatus {
+		return ensureActive(t.TransactionId, t.status)
+	}
+
+	t.rollback()
+	t.cascadingAbort = nil
+	t.status = RolledBackStatus
+
+	return nil
+}
+
+// rollback aborts the transactions depending on this one first, they may have
+// overwritten its writes.
+func (t *TwoPhaseLocking) rollback() {
+	dependents := make([]*TwoPhaseLocking, 0)
+	for dependent := range t.Table.dependents[t.TransactionId] {
+		dependents = append(dependents, dependent)
+	}
+
+	slices.SortFunc(dependents, func(a, b *TwoPhaseLocking) int { return cmp.Compare(a.TransactionId, b.TransactionId) })
+
+	for _, dependent := range dependents {
+		dependent.cascade(t.TransactionId, t.Table.dependents[t.TransactionId][dependent])
+	}
+
 	for i := len(t.Operations) - 1; i >= 0; i-- {
 		op := t.Operations[i]
 
 		row := t.Table.Data[op.Key]
-		row.UncommittedByTxId[t.TransactionId] = op.FromValue
+		row.LatestUncommitted = op.FromValue
+		delete(row.UncommittedByTxId, t.TransactionId)
 		t.Table.Data[op.Key] = row
 	}
 
-	t.locks.UnlockAll()
-	t.Table.DeleteSnapshot(t.TransactionId)
+	t.finish()
+}
+
+// finish releases everything the transaction held, transactions that depended
+// on it no longer do.
+func (t *TwoPhaseLocking) finish() {
+	for writer := range t.dependencies {
+		delete(t.Table.dependents[writer], t)
+	}
+
+	delete(t.Table.dependents, t.TransactionId)
+	t.locks.UnlockAll(t.TransactionId)
 	t.Operations = make([]Operation, 0)
 	t.keysTouched = make(map[Key]struct{})
+	t.isShrinking = false
+	t.dependencies = make(map[TransactionId]Key)
+}
 
-	return t
+// fail aborts the transaction after an operation was refused, it stays
+// aborted until rolled back.
+func (t *TwoPhaseLocking) fail(err error) error {
+	t.rollback()
+	t.status = AbortedStatus
+
+	return err
 }
 
-func (t *TwoPhaseLocking) Commit() Transaction {
+func (t *TwoPhaseLocking) TryCommit() error {
+	if err := t.ensureActive(); err != nil {
+		return err
+	}
+
+	if err := t.locks.TakeWound(t.TransactionId); err != nil {
+		t.rollback()
+		t.status = RolledBackStatus
+
+		return err
+	}
+
+	writers := make([]TransactionId, 0)
+	for writer := range t.dependencies {
+		writers = append(writers, writer)
+	}
+
+	slices.Sort(writers)
+
+	for _, writer := range writers {
+		if _, isUnfinished := t.Table.dependents[writer]; isUnfinished {
+			return &UncommittedDependencyError{TxId: t.TransactionId, Writer: writer, Key: t.dependencies[writer]}
+		}
+	}
+
 	for _, op := range t.Operations {
 		t.Table.SetCommitted(op.Key, op.ToValue, t.TransactionId)
 	}
 
-	t.locks.UnlockAll()
-	t.Table.DeleteSnapshot(t.TransactionId)
-	t.Operations = make([]Operation, 0)
-	t.keysTouched = make(map[Key]struct{})
+	t.finish()
+	t.status = CommittedStatus
 
-	return t
+	return nil
 }
 
 func (t *TwoPhaseLocking) GetKeysTouched() []Key {
@@ -124,3 +425,73 @@ func (t *TwoPhaseLocking) GetKeysTouched() []Key {
 func (t *TwoPhaseLocking) GetLocks() *TransactionLocks {
 	return t.locks
 }
+
+func (t *TwoPhaseLocking) Set(key Key, value Value) Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TrySet(key, value)
+	return t
+}
+
+func (t *TwoPhaseLocking) Delete(key Key) Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TryDelete(key)
+	return t
+}
+
+func (t *TwoPhaseLocking) Get(key Key) Value {
+	t.status = reopened(t.status)
+	value, err := t.TryGet(key)
+	t.err = err
+	return value
+}
+
+func (t *TwoPhaseLocking) Scan(from Key, to Key) []KeyValue {
+	t.status = reopened(t.status)
+	rows, err := t.TryScan(from, to)
+	t.err = err
+	return rows
+}
+
+func (t *TwoPhaseLocking) Shrink() Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TryShrink()
+	return t
+}
+
+func (t *TwoPhaseLocking) Lock(key Key) Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TryLock(key)
+	return t
+}
+
+func (t *TwoPhaseLocking) LockWith(key Key, mode LockMode) Transaction {
+	t.status = reopened(t.status)
+	_, t.err = t.TryLockWith(key, mode)
+	return t
+}
+
+func (t *TwoPhaseLocking) LockTable(lockLevel LockLevel) Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TryLockTable(lockLevel)
+	return t
+}
+
+func (t *TwoPhaseLocking) Rollback() Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TryRollback()
+	return t
+}
+
+func (t *TwoPhaseLocking) Commit() Transaction {
+	t.status = reopened(t.status)
+	t.err = t.TryCommit()
+	return t
+}
+
+func (t *TwoPhaseLocking) GetStatus() TransactionStatus {
+	return t.status
+}
+
+func (t *TwoPhaseLocking) GetError() error {
+	return t.err
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestShrinkingReleasesLocksOfVariant(t *testing.T) {
+	tests := []struct {
+		variant TwoPhaseLockingVariant
+		want    map[Key]LockLevel
+	}{
+		{variant: StrictTwoPhaseLocking, want: map[Key]LockLevel{"y": ReadWrite}},
+		{variant: NonStrictTwoPhaseLocking, want: map[Key]LockLevel{}},
+		{variant: RigorousTwoPhaseLocking, want: map[Key]LockLevel{"x": Read, "y": ReadWrite}},
+	}
+
+	for _, tt := range tests {
+		table := NewTable()
+		table.Data["x"] = NewRow("x", "0")
+		table.Data["y"] = NewRow("y", "0")
+		table.TwoPhaseLockingVariant = tt.variant
+
+		tx := NewTwoPhaseLocking("t1", &table)
+		tx.Get("x")
+		tx.Set("y", "1").(*TwoPhaseLocking).Shrink()
+
+		if got := tx.GetLocks().GetLockLevels(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: got %v, want %v", tt.variant, got, tt.want)
+		}
+	}
+}
+
+func TestShrinkingTransactionTakesNoNewLock(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "0")
+	table.Data["y"] = NewRow("y", "0")
+	table.TwoPhaseLockingVariant = RigorousTwoPhaseLocking
+
+	tx := NewTwoPhaseLocking("t1", &table)
+	tx.Get("x")
+	tx.Shrink()
+
+	if _, err := tx.TryGet("x"); err != nil {
+		t.Errorf("expected the held lock to be usable, got error: %v", err)
+	}
+
+	if _, err := tx.TryGet("y"); !errors.Is(err, ErrLockAfterShrinking) {
+		t.Errorf("got %v, want %v", err, ErrLockAfterShrinking)
+	}
+
+	if err := tx.TrySet("x", "1"); !errors.Is(err, ErrLockAfterShrinking) {
+		t.Errorf("got %v, want %v", err, ErrLockAfterShrinking)
+	}
+
+	if status := tx.GetStatus(); status != ActiveStatus {
+		t.Errorf("got %v, want %v", status, ActiveStatus)
+	}
+}
+
+func TestNonStrictTwoPhaseLockingCascadesAborts(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "0")
+	table.TwoPhaseLockingVariant = NonStrictTwoPhaseLocking
+
+	writer := NewTwoPhaseLocking("t1", &table)
+	writer.Set("x", "1").(*TwoPhaseLocking).Shrink()
+
+	reader := NewTwoPhaseLocking("t2", &table)
+	if value := reader.Get("x"); value != "1" {
+		t.Errorf("got %v, want %v", value, "1")
+	}
+
+	var dependencyErr *UncommittedDependencyError
+	if err := reader.TryCommit(); !errors.As(err, &dependencyErr) {
+		t.Errorf("got %v, want uncommitted dependency error", err)
+	}
+
+	writer.Rollback()
+
+	if status := reader.GetStatus(); status != AbortedStatus {
+		t.Errorf("got %v, want %v", status, AbortedStatus)
+	}
+
+	want := "t2 aborted in cascade, t1 rolled back its uncommitted write of x"
+	if err := reader.TryCommit(); err == nil || err.Error() != want {
+		t.Errorf("got %v, want %v", err, want)
+	}
+
+	if got := table.Data["x"].LatestUncommitted; got != "0" {
+		t.Errorf("got %v, want %v", got, "0")
+	}
+}
+
+func TestCascadingAbortUndoesOverwritesFirst(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "0")
+	table.TwoPhaseLockingVariant = NonStrictTwoPhaseLocking
+
+	writer := NewTwoPhaseLocking("t1", &table)
+	writer.Set("x", "1").(*TwoPhaseLocking).Shrink()
+
+	overwriter := NewTwoPhaseLocking("t2", &table)
+	overwriter.Set("x", "2")
+
+	writer.Rollback()
+
+	if status := overwriter.GetStatus(); status != AbortedStatus {
+		t.Errorf("got %v, want %v", status, AbortedStatus)
+	}
+
+	if got := table.Data["x"].LatestUncommitted; got != "0" {
+		t.Errorf("got %v, want %v", got, "0")
+	}
+}
+
+func TestNonStrictTwoPhaseLockingCommitsAfterWriter(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "0")
+	table.TwoPhaseLockingVariant = NonStrictTwoPhaseLocking
+
+	writer := NewTwoPhaseLocking("t1", &table)
+	writer.Set("x", "1").(*TwoPhaseLocking).Shrink()
+
+	reader := NewTwoPhaseLocking("t2", &table)
+	reader.Get("x")
+
+	writer.Commit()
+
+	if err := reader.TryCommit(); err != nil {
+		t.Errorf("expected the reader to commit after the writer, got error: %v", err)
+	}
+}
+
+func TestPlayEventDrawsCommitDeferredOnUncommittedDependency(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "0")
+	table.TwoPhaseLockingVariant = NonStrictTwoPhaseLocking
+
+	writer := NewTwoPhaseLocking("t1", &table)
+	writer.Set("x", "1").(*TwoPhaseLocking).Shrink()
+
+	reader := NewTwoPhaseLocking("t2", &table)
+	reader.Get("x")
+
+	mermaid := NewMermaidBuilder()
+	mermaid.EnsureParticipantAdded("x", RowParticipant, Materialized, Static)
+	mermaid.EnsureParticipantAdded("t2", TransactionParticipant, Materialized, Static)
+
+	commit := NewCommit("t2", TwoPhaseLockingLevel)
+	playEvent(mermaid, &table, reader, commit)
+
+	var dependencyErr *UncommittedDependencyError
+	if !errors.As(commit.Err, &dependencyErr) {
+		t.Errorf("got %v, want uncommitted dependency error", commit.Err)
+	}
+
+	got := mermaid.Build()
+	if !strings.Contains(got, "x ->> t2: commit deferred") || strings.Contains(got, "abort") {
+		t.Errorf("got %v, want the commit drawn as deferred", got)
+	}
+
+	if status := reader.GetStatus(); status != ActiveStatus {
+		t.Errorf("got %v, want %v", status, ActiveStatus)
+	}
+}
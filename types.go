@@ -1,7 +1,9 @@
 package main
 
 import (
+	"cmp"
 	"fmt"
+	"slices"
 )
 
 type Key string
@@ -22,17 +24,92 @@ func EmptyValue() Value {
 	return "<empty>"
 }
 
+// TombstoneValue marks a deleted row, or one whose insert is not committed.
+func TombstoneValue() Value {
+	return "<deleted>"
+}
+
+func visibleValue(value Value) Value {
+	if value == TombstoneValue() {
+		return EmptyValue()
+	}
+
+	return value
+}
+
+// KeyValue is a row as seen by a scan.
+type KeyValue struct {
+	Key   Key
+	Value Value
+}
+
+func (kv KeyValue) String() string {
+	return fmt.Sprintf("%v=%v", kv.Key, kv.Value)
+}
+
+// scanRows reads every key of the table between from and to with get, in key
+// order, leaving out the ones get finds missing.
+func scanRows(table *Table, from Key, to Key, get func(key Key) (Value, error)) ([]KeyValue, error) {
+	res := make([]KeyValue, 0)
+
+	for _, key := range table.KeysBetween(from, to) {
+		value, err := get(key)
+		if err != nil {
+			return nil, err
+		}
+
+		if value != EmptyValue() {
+			res = append(res, KeyValue{Key: key, Value: value})
+		}
+	}
+
+	return res, nil
+}
+
+// withBufferedInserts adds to the rows of a scan the keys in its range that a
+// transaction buffered writes of but that are not in the table yet.
+func withBufferedInserts(table *Table, rows []KeyValue, writeSet map[Key]Value, from Key, to Key) []KeyValue {
+	for key, value := range writeSet {
+		_, isInTable := table.Data[key]
+		if isInTable || !isBetween(key, from, to) || value == TombstoneValue() {
+			continue
+		}
+
+		rows = append(rows, KeyValue{Key: key, Value: value})
+	}
+
+	slices.SortFunc(rows, func(a, b KeyValue) int { return cmp.Compare(a.Key, b.Key) })
+
+	return rows
+}
+
 type Operation struct {
 	Key       Key
 	FromValue Value
 	ToValue   Value
 }
 
+// Version is a committed value of a row, stamped with the timestamp of the
+// commit that installed it. Multi-version timestamp ordering also stamps it
+// with the timestamp of its writer and of its youngest reader.
+type Version struct {
+	Value    Value
+	CommitTs int
+	WriteTs  int
+	ReadTs   int
+}
+
+// Row holds the chain of its committed versions, oldest first. Committed is
+// the value of the latest one. ReadTs and WriteTs are the timestamps of the
+// youngest timestamp ordering transactions that read and wrote it.
 type Row struct {
 	Key               Key
 	Committed         Value
 	LatestUncommitted Value
 	UncommittedByTxId map[TransactionId]Value
+	Versions          []Version         `json:"-"`
+	ReadTs            int               `json:"-"`
+	WriteTs           int               `json:"-"`
 	Lock              *TrackableRWMutex `json:"-"`
 }
 
@@ -42,34 +119,160 @@ func NewRow(key Key, value Value) Row {
 		Committed:         value,
 		LatestUncommitted: value,
 		UncommittedByTxId: make(map[TransactionId]Value),
+		Versions:          []Version{{Value: value, CommitTs: 0, WriteTs: 0, ReadTs: 0}},
+		ReadTs:            0,
+		WriteTs:           0,
 		Lock:              NewTrackableRWMutex(),
 	}
 }
 
+// VersionAt returns the latest version of the row committed at or before ts.
+func (r Row) VersionAt(ts int) (Version, bool) {
+	for i := len(r.Versions) - 1; i >= 0; i-- {
+		if r.Versions[i].CommitTs <= ts {
+			return r.Versions[i], true
+		}
+	}
+
+	return Version{}, false
+}
+
+// Snapshot is the committed value of every key as a transaction sees it.
 type Snapshot map[Key]Value
 
+// Table is a multi-version store, committing a value appends a version to
+// the chain of its row. A snapshot is only the timestamp the transaction
+// started at, reading from it picks the latest version committed by then.
 type Table struct {
-	Data      map[Key]Row
-	snapshots map[TransactionId]Snapshot
+	Data               map[Key]Row
+	LockManager        *LockManager
+	clock              int
+	startTimestamps    map[TransactionId]int
+	rwAntidependencies *RwAntidependencies
+	rangeLocks         map[keyRange]*TrackableRWMutex
+	timestamps         int
+	rangeReadTs        map[keyRange]int
+	// runningTimestamps are the timestamps of the multi-version timestamp
+	// ordering transactions that have not finished yet.
+	runningTimestamps map[int]struct{}
+	// ThomasWriteRule makes timestamp ordering ignore writes that a younger
+	// transaction already overwrote instead of aborting them.
+	ThomasWriteRule bool
+	// TwoPhaseLockingVariant tells which locks two phase locking releases once
+	// a transaction starts shrinking.
+	TwoPhaseLockingVariant TwoPhaseLockingVariant
+	dependents             map[TransactionId]map[*TwoPhaseLocking]Key
+	// lock is the lock of the whole table, row locks take an intention lock on
+	// it first.
+	lock *TrackableRWMutex
+	// LockEscalationThreshold is the number of row locks a transaction may
+	// hold before trading them for a lock on the whole table, zero never does.
+	LockEscalationThreshold int
+	History                 *History
 }
 
 func NewTable() Table {
 	return Table{
-		Data:      make(map[Key]Row),
-		snapshots: make(map[TransactionId]Snapshot),
+		Data:                    make(map[Key]Row),
+		LockManager:             NewLockManager(),
+		clock:                   0,
+		startTimestamps:         make(map[TransactionId]int),
+		rwAntidependencies:      NewRwAntidependencies(),
+		rangeLocks:              make(map[keyRange]*TrackableRWMutex),
+		timestamps:              0,
+		rangeReadTs:             make(map[keyRange]int),
+		runningTimestamps:       make(map[int]struct{}),
+		ThomasWriteRule:         false,
+		TwoPhaseLockingVariant:  StrictTwoPhaseLocking,
+		dependents:              make(map[TransactionId]map[*TwoPhaseLocking]Key),
+		lock:                    NewTrackableRWMutex(),
+		LockEscalationThreshold: 0,
+		History:                 nil,
+	}
+}
+
+// KeysBetween returns the keys of the table from from to to, both included,
+// in lexicographic order. Rows that were deleted or whose insert is not
+// committed have keys too, whether a transaction sees them is up to its
+// level.
+func (t *Table) KeysBetween(from Key, to Key) []Key {
+	res := make([]Key, 0)
+
+	for key := range t.Data {
+		if isBetween(key, from, to) {
+			res = append(res, key)
+		}
+	}
+
+	slices.Sort(res)
+
+	return res
+}
+
+func isBetween(key Key, from Key, to Key) bool {
+	return from <= key && key <= to
+}
+
+// keyRange is the range of keys from from to to, both included.
+type keyRange struct {
+	from Key
+	to   Key
+}
+
+func (r keyRange) contains(key Key) bool {
+	return isBetween(key, r.from, r.to)
+}
+
+// rangeLock returns the lock of a range of keys, ranges are locked as a whole
+// whether their keys exist or not.
+func (t *Table) rangeLock(keyRange keyRange) *TrackableRWMutex {
+	mutex, ok := t.rangeLocks[keyRange]
+	if !ok {
+		mutex = NewTrackableRWMutex()
+		t.rangeLocks[keyRange] = mutex
 	}
+
+	return mutex
+}
+
+// rangesCovering returns the locked ranges key falls into, ordered by their
+// first and then their last key.
+func (t *Table) rangesCovering(key Key) []keyRange {
+	res := make([]keyRange, 0)
+
+	for keyRange := range t.rangeLocks {
+		if keyRange.contains(key) {
+			res = append(res, keyRange)
+		}
+	}
+
+	slices.SortFunc(res, func(a, b keyRange) int {
+		if a.from != b.from {
+			return cmp.Compare(a.from, b.from)
+		}
+
+		return cmp.Compare(a.to, b.to)
+	})
+
+	return res
 }
 
 func (t *Table) GetCommitted(key Key, txId TransactionId) (Value, bool) {
-	if value, ok := t.snapshots[txId][key]; ok {
-		return value, true
+	row, ok := t.Data[key]
+	if !ok {
+		return EmptyValue(), false
 	}
 
-	if row, ok := t.Data[key]; ok {
+	startTs, hasSnapshot := t.startTimestamps[txId]
+	if !hasSnapshot {
 		return row.Committed, true
 	}
 
-	return EmptyValue(), false
+	if version, ok := row.VersionAt(startTs); ok {
+		return version.Value, true
+	}
+
+	return TombstoneValue(), true
 }
 
 func (t *Table) SetCommitted(key Key, value Value, txId TransactionId) {
@@ -79,65 +282,153 @@ func (t *Table) SetCommitted(key Key, value Value, txId TransactionId) {
 		panic("key not found")
 	}
 
-	for snapshotTxid, snapshot := range t.snapshots {
-		if snapshotTxid == txId {
-			continue
-		}
-
-		if _, ok := snapshot[key]; !ok {
-			t.snapshots[snapshotTxid][key] = row.Committed
-		}
-
-	}
+	t.clock++
 
 	row.Committed = value
 	row.LatestUncommitted = value
+	row.Versions = append(row.Versions, Version{Value: value, CommitTs: t.clock})
 	delete(row.UncommittedByTxId, txId)
 
 	t.Data[key] = row
 }
 
 func (t *Table) EnsureSnapshotTaken(txId TransactionId) {
-	if _, ok := t.snapshots[txId]; ok {
+	if _, ok := t.startTimestamps[txId]; ok {
 		return
 	}
 
-	t.snapshots[txId] = make(Snapshot)
+	t.startTimestamps[txId] = t.clock
+}
+
+func (t *Table) IsCommittedSinceSnapshot(key Key, txId TransactionId) bool {
+	startTs, ok := t.startTimestamps[txId]
+	if !ok {
+		return false
+	}
+
+	versions := t.Data[key].Versions
+
+	return len(versions) > 0 && versions[len(versions)-1].CommitTs > startTs
 }
 
 func (t *Table) DeleteSnapshot(txId TransactionId) {
-	delete(t.snapshots, txId)
+	delete(t.startTimestamps, txId)
 }
 
+// GetSnapshot returns the values the snapshot of txId holds, if it has one.
 func (t *Table) GetSnapshot(txId TransactionId) (Snapshot, bool) {
-	snapshot, ok := t.snapshots[txId]
-	return snapshot, ok
+	if _, ok := t.startTimestamps[txId]; !ok {
+		return nil, false
+	}
+
+	snapshot := make(Snapshot)
+	for key := range t.Data {
+		snapshot[key], _ = t.GetCommitted(key, txId)
+	}
+
+	return snapshot, true
+}
+
+type TransactionStatus int
+
+const (
+	ActiveStatus TransactionStatus = iota
+	AbortedStatus
+	CommittedStatus
+	RolledBackStatus
+)
+
+func (s TransactionStatus) String() string {
+	switch s {
+	case ActiveStatus:
+		return "active"
+	case AbortedStatus:
+		return "aborted"
+	case CommittedStatus:
+		return "committed"
+	case RolledBackStatus:
+		return "rolled back"
+	default:
+		return fmt.Sprintf("TransactionStatus(%d)", int(s))
+	}
+}
+
+func ensureActive(txId TransactionId, status TransactionStatus) error {
+	if status == ActiveStatus {
+		return nil
+	}
+
+	return &TransactionFinishedError{TxId: txId, Status: status}
+}
+
+// reopened lets the chaining methods of Transaction start over after a commit
+// or rollback, an aborted transaction still has to be rolled back first.
+func reopened(status TransactionStatus) TransactionStatus {
+	if status == CommittedStatus || status == RolledBackStatus {
+		return ActiveStatus
+	}
+
+	return status
+}
+
+type FallibleTransaction interface {
+	TrySet(key Key, value Value) error
+	TryDelete(key Key) error
+	TryGet(key Key) (Value, error)
+	TryScan(from Key, to Key) ([]KeyValue, error)
+	TryLock(key Key) error
+	TryLockWith(key Key, mode LockMode) (bool, error)
+	TryLockTable(lockLevel LockLevel) error
+	TryRollback() error
+	TryCommit() error
 }
 
 type Transaction interface {
+	FallibleTransaction
 	Set(key Key, value Value) Transaction
+	Delete(key Key) Transaction
 	Get(key Key) Value
+	Scan(from Key, to Key) []KeyValue
 	Lock(key Key) Transaction
+	LockWith(key Key, mode LockMode) Transaction
+	LockTable(lockLevel LockLevel) Transaction
 	Rollback() Transaction
 	Commit() Transaction
 	GetKeysTouched() []Key
 	GetLocks() *TransactionLocks
+	GetStatus() TransactionStatus
+	GetError() error
 }
 
 func TransactionFromTransactionLevel(level TransactionLevel, txId TransactionId, table *Table) (Transaction, error) {
+	var tx Transaction
 
 	switch level {
 	case ReadUncommittedLevel:
-		return NewReadUncommitted(txId, table), nil
+		tx = NewReadUncommitted(txId, table)
 	case ReadCommittedLevel:
-		return NewReadCommitted(txId, table), nil
+		tx = NewReadCommitted(txId, table)
 	case SnapshotIsolationLevel:
-		return NewSnapshotIsolation(txId, table), nil
+		tx = NewSnapshotIsolation(txId, table)
 	case TwoPhaseLockingLevel:
-		return NewTwoPhaseLocking(txId, table), nil
+		tx = NewTwoPhaseLocking(txId, table)
+	case SerializableSnapshotIsolationLevel:
+		tx = NewSerializableSnapshotIsolation(txId, table)
+	case OptimisticConcurrencyControlLevel:
+		tx = NewOptimisticConcurrencyControl(txId, table)
+	case TimestampOrderingLevel:
+		tx = NewTimestampOrdering(txId, table)
+	case MultiVersionTimestampOrderingLevel:
+		tx = NewMultiVersionTimestampOrdering(txId, table)
 	default:
 		return nil, fmt.Errorf("unknown transactionLevel %v", level)
 	}
+
+	if table.History != nil {
+		return NewRecordedTransaction(txId, tx, table.History), nil
+	}
+
+	return tx, nil
 }
 
 type TransactionLevel int
@@ -147,8 +438,48 @@ const (
 	ReadCommittedLevel
 	SnapshotIsolationLevel
 	TwoPhaseLockingLevel
+	SerializableSnapshotIsolationLevel
+	OptimisticConcurrencyControlLevel
+	TimestampOrderingLevel
+	MultiVersionTimestampOrderingLevel
 )
 
+func TransactionLevels() []TransactionLevel {
+	return []TransactionLevel{
+		ReadUncommittedLevel,
+		ReadCommittedLevel,
+		SnapshotIsolationLevel,
+		TwoPhaseLockingLevel,
+		SerializableSnapshotIsolationLevel,
+		OptimisticConcurrencyControlLevel,
+		TimestampOrderingLevel,
+		MultiVersionTimestampOrderingLevel,
+	}
+}
+
+func (l TransactionLevel) String() string {
+	switch l {
+	case ReadUncommittedLevel:
+		return "read uncommitted"
+	case ReadCommittedLevel:
+		return "read committed"
+	case SnapshotIsolationLevel:
+		return "snapshot isolation"
+	case TwoPhaseLockingLevel:
+		return "two phase locking"
+	case SerializableSnapshotIsolationLevel:
+		return "serializable snapshot isolation"
+	case OptimisticConcurrencyControlLevel:
+		return "optimistic concurrency control"
+	case TimestampOrderingLevel:
+		return "timestamp ordering"
+	case MultiVersionTimestampOrderingLevel:
+		return "multi-version timestamp ordering"
+	default:
+		return fmt.Sprintf("TransactionLevel(%d)", int(l))
+	}
+}
+
 type EventType int
 
 const (
@@ -162,6 +493,10 @@ const (
 	ReadOperation
 	Commit
 	Rollback
+	DeleteOperation
+	ScanOperation
+	LockOperation
+	LockTableOperation
 )
 
 type TableEvent struct {
@@ -170,7 +505,14 @@ type TableEvent struct {
 	OperationType OperationType
 	Key           Key
 	To            Value
+	End           Key
+	LockMode      LockMode
+	LockLevel     LockLevel
 	Position      int
+	Observed      Value
+	Err           error
+	// Status is the status the event left its transaction in once played.
+	Status TransactionStatus
 }
 
 func NewRead(
@@ -202,6 +544,72 @@ func NewWrite(
 	}}
 }
 
+func NewDelete(
+	txId TransactionId,
+	txLevel TransactionLevel,
+	key Key,
+) Event {
+	return Event{TableEvent: &TableEvent{
+		TxId:          txId,
+		TxLevel:       txLevel,
+		OperationType: DeleteOperation,
+		Key:           key,
+		To:            TombstoneValue(),
+	}}
+}
+
+// NewScan reads the rows with keys from from to to, both included. The event
+// keeps from as its Key and to as its End.
+func NewScan(
+	txId TransactionId,
+	txLevel TransactionLevel,
+	from Key,
+	to Key,
+) Event {
+	return Event{TableEvent: &TableEvent{
+		TxId:          txId,
+		TxLevel:       txLevel,
+		OperationType: ScanOperation,
+		Key:           from,
+		To:            EmptyValue(),
+		End:           to,
+	}}
+}
+
+// NewLock locks the row of key as mode asks, like SELECT ... FOR UPDATE or
+// FOR SHARE, without reading it.
+func NewLock(
+	txId TransactionId,
+	txLevel TransactionLevel,
+	key Key,
+	mode LockMode,
+) Event {
+	return Event{TableEvent: &TableEvent{
+		TxId:          txId,
+		TxLevel:       txLevel,
+		OperationType: LockOperation,
+		Key:           key,
+		To:            EmptyValue(),
+		LockMode:      mode,
+	}}
+}
+
+// NewLockTable locks the whole table at lockLevel, like LOCK TABLE.
+func NewLockTable(
+	txId TransactionId,
+	txLevel TransactionLevel,
+	lockLevel LockLevel,
+) Event {
+	return Event{TableEvent: &TableEvent{
+		TxId:          txId,
+		TxLevel:       txLevel,
+		OperationType: LockTableOperation,
+		Key:           EmptyKey(),
+		To:            EmptyValue(),
+		LockLevel:     lockLevel,
+	}}
+}
+
 func NewCommit(
 	txId TransactionId,
 	txLevel TransactionLevel,
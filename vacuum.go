@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+)
+
+// VacuumStats tells what a vacuum did. OldestXmin is the start timestamp of
+// the oldest snapshot still open, or the current timestamp if there is none,
+// zero while a multi-version timestamp ordering transaction runs.
+type VacuumStats struct {
+	Pruned     int
+	Retained   int
+	OldestXmin int
+}
+
+func (s VacuumStats) String() string {
+	return fmt.Sprintf("pruned %d versions, retained %d, oldest xmin %d", s.Pruned, s.Retained, s.OldestXmin)
+}
+
+// OldestXmin returns the timestamp no snapshot is older than. A running
+// multi-version timestamp ordering transaction holds it at zero, it picks the
+// version it reads by write timestamp rather than by commit so any of them
+// may still be the one it sees.
+func (t *Table) OldestXmin() int {
+	if len(t.runningTimestamps) > 0 {
+		return 0
+	}
+
+	xmin := t.clock
+
+	for _, startTs := range t.startTimestamps {
+		xmin = min(xmin, startTs)
+	}
+
+	return xmin
+}
+
+// Vacuum prunes the versions no transaction can still see. Of the versions
+// committed by the oldest xmin only the latest is visible to anyone, the
+// older ones are dropped. A long running transaction holds the oldest xmin
+// back, so every version committed after it started is retained. The version
+// with the largest write timestamp is retained too, multi-version timestamp
+// ordering reads it even when it was not committed last.
+func (t *Table) Vacuum() VacuumStats {
+	stats := VacuumStats{
+		Pruned:     0,
+		Retained:   0,
+		OldestXmin: t.OldestXmin(),
+	}
+
+	for key, row := range t.Data {
+		oldest := 0
+		for i, version := range row.Versions {
+			if version.CommitTs <= stats.OldestXmin {
+				oldest = i
+			}
+		}
+		oldest = min(oldest, row.versionBefore(t.timestamps+1))
+
+		if oldest > 0 {
+			row.Versions = append([]Version{}, row.Versions[oldest:]...)
+			t.Data[key] = row
+		}
+
+		stats.Pruned += oldest
+		stats.Retained += len(row.Versions)
+	}
+
+	return stats
+}
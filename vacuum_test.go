@@ -0,0 +1,112 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestVacuumKeepsLatestVersionWithoutOpenSnapshots(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "A")
+	table.Data["y"] = NewRow("y", "A")
+
+	for _, value := range []Value{"B", "C", "D"} {
+		NewSnapshotIsolation("1", &table).Set("x", value).Commit()
+	}
+
+	stats := table.Vacuum()
+
+	want := VacuumStats{Pruned: 3, Retained: 2, OldestXmin: 3}
+	if stats != want {
+		t.Errorf("got %v, want %v", stats, want)
+	}
+
+	if versions := table.Data["x"].Versions; len(versions) != 1 || versions[0].Value != "D" {
+		t.Errorf("got %v, want only D", versions)
+	}
+}
+
+func TestLongRunningTransactionHoldsVersionsBack(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "A")
+
+	NewSnapshotIsolation("1", &table).Set("x", "B").Commit()
+
+	longRunning := NewSnapshotIsolation("long-running", &table)
+	longRunning.Get("x")
+
+	for _, value := range []Value{"C", "D", "E"} {
+		NewSnapshotIsolation("1", &table).Set("x", value).Commit()
+	}
+
+	stats := table.Vacuum()
+
+	want := VacuumStats{Pruned: 1, Retained: 4, OldestXmin: 1}
+	if stats != want {
+		t.Errorf("got %v, want %v", stats, want)
+	}
+
+	if value := longRunning.Get("x"); value != "B" {
+		t.Errorf("got %v, want %v", value, "B")
+	}
+
+	longRunning.Commit()
+
+	stats = table.Vacuum()
+
+	want = VacuumStats{Pruned: 3, Retained: 1, OldestXmin: 4}
+	if stats != want {
+		t.Errorf("got %v, want %v", stats, want)
+	}
+}
+
+func TestRunningMultiVersionTimestampOrderingHoldsVersionsBack(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "A")
+
+	older := NewMultiVersionTimestampOrdering("1", &table)
+	older.Get("x")
+
+	NewMultiVersionTimestampOrdering("2", &table).Set("x", "B").Commit()
+
+	stats := table.Vacuum()
+
+	want := VacuumStats{Pruned: 0, Retained: 2, OldestXmin: 0}
+	if stats != want {
+		t.Errorf("got %v, want %v", stats, want)
+	}
+
+	if value := older.Get("x"); value != "A" {
+		t.Errorf("got %v, want %v", value, "A")
+	}
+
+	older.Commit()
+
+	stats = table.Vacuum()
+
+	want = VacuumStats{Pruned: 1, Retained: 1, OldestXmin: 1}
+	if stats != want {
+		t.Errorf("got %v, want %v", stats, want)
+	}
+}
+
+func TestVacuumKeepsVersionWithLargestWriteTimestamp(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "A")
+
+	older := NewMultiVersionTimestampOrdering("1", &table)
+	older.Set("x", "B")
+
+	NewMultiVersionTimestampOrdering("2", &table).Set("x", "C").Commit()
+	older.Commit()
+
+	stats := table.Vacuum()
+
+	want := VacuumStats{Pruned: 1, Retained: 2, OldestXmin: 2}
+	if stats != want {
+		t.Errorf("got %v, want %v", stats, want)
+	}
+
+	if value := NewMultiVersionTimestampOrdering("3", &table).Get("x"); value != "C" {
+		t.Errorf("got %v, want %v", value, "C")
+	}
+}
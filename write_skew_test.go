@@ -1,7 +1,7 @@
 package main
 
 import (
-	"sync"
+	"errors"
 	"testing"
 )
 
@@ -10,36 +10,40 @@ func TestWriteSkew(t *testing.T) {
 	table.Data["doctor-a-is-on-call"] = NewRow("doctor-a-is-on-call", "true")
 	table.Data["doctor-b-is-on-call"] = NewRow("doctor-b-is-on-call", "true")
 
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go func() {
-		doctorB := NewTwoPhaseLocking("doctor-b", &table)
+	scheduler := NewScheduler(table.LockManager)
+	table.LockManager.SetObserver(scheduler)
 
-		isDoctorAOnCall := doctorB.Get("doctor-a-is-on-call") == "true"
+	doctorA := NewTwoPhaseLocking("doctor-a", &table)
+	doctorB := NewTwoPhaseLocking("doctor-b", &table)
 
-		if isDoctorAOnCall {
-			doctorB.Lock("doctor-b-is-on-call").Set("doctor-b-is-on-call", "false")
-		}
+	var isDoctorAOnCall, isDoctorBOnCall bool
 
-		doctorB.Commit()
-		wg.Done()
-	}()
+	scheduler.Schedule("doctor-b", func() {
+		isDoctorAOnCall = doctorB.Get("doctor-a-is-on-call") == "true"
+	}, func() {})
 
-	wg.Add(1)
-	go func() {
-		doctorA := NewTwoPhaseLocking("doctor-a", &table)
+	scheduler.Schedule("doctor-a", func() {
+		isDoctorBOnCall = doctorA.Get("doctor-b-is-on-call") == "true"
+	}, func() {})
 
-		isDoctorBOnCall := doctorA.Get("doctor-b-is-on-call") == "true"
+	scheduler.Schedule("doctor-b", func() {
+		if isDoctorAOnCall {
+			doctorB.Lock("doctor-b-is-on-call").Set("doctor-b-is-on-call", "false")
+		}
+	}, func() {})
 
+	scheduler.Schedule("doctor-a", func() {
 		if isDoctorBOnCall {
 			doctorA.Lock("doctor-a-is-on-call").Set("doctor-a-is-on-call", "false")
 		}
+	}, func() {})
 
-		doctorA.Commit()
-		wg.Done()
-	}()
+	scheduler.Schedule("doctor-b", func() { doctorB.Commit() }, func() {})
+	scheduler.Schedule("doctor-a", func() { doctorA.Commit() }, func() {})
 
-	wg.Wait()
+	if err := scheduler.Wait(); err != nil {
+		t.Fatalf("expected every doctor to finish, got error: %v", err)
+	}
 
 	isDoctorAOutSick := table.Data["doctor-a-is-on-call"].Committed == "false"
 	isDoctorBOutSick := table.Data["doctor-b-is-on-call"].Committed == "false"
@@ -52,3 +56,120 @@ func TestWriteSkew(t *testing.T) {
 		t.Error("write skew occurred, both doctors are out sick, but one should be on call")
 	}
 }
+
+func TestWriteSkewUnderSnapshotIsolation(t *testing.T) {
+	table := NewTable()
+	table.Data["doctor-a-is-on-call"] = NewRow("doctor-a-is-on-call", "true")
+	table.Data["doctor-b-is-on-call"] = NewRow("doctor-b-is-on-call", "true")
+
+	doctorA := NewSnapshotIsolation("doctor-a", &table)
+	doctorB := NewSnapshotIsolation("doctor-b", &table)
+
+	testTakingTurnsGoingOffCall(doctorA, doctorB)
+
+	isDoctorAOutSick := table.Data["doctor-a-is-on-call"].Committed == "false"
+	isDoctorBOutSick := table.Data["doctor-b-is-on-call"].Committed == "false"
+
+	if !isDoctorAOutSick || !isDoctorBOutSick {
+		t.Error("expected snapshot isolation to let write skew through")
+	}
+}
+
+func TestWriteSkewUnderSerializableSnapshotIsolation(t *testing.T) {
+	table := NewTable()
+	table.Data["doctor-a-is-on-call"] = NewRow("doctor-a-is-on-call", "true")
+	table.Data["doctor-b-is-on-call"] = NewRow("doctor-b-is-on-call", "true")
+
+	doctorA := NewSerializableSnapshotIsolation("doctor-a", &table)
+	doctorB := NewSerializableSnapshotIsolation("doctor-b", &table)
+
+	testTakingTurnsGoingOffCall(doctorA, doctorB)
+
+	isDoctorAOutSick := table.Data["doctor-a-is-on-call"].Committed == "false"
+	isDoctorBOutSick := table.Data["doctor-b-is-on-call"].Committed == "false"
+
+	if !isDoctorAOutSick && !isDoctorBOutSick {
+		t.Error("at least one doctor should be able to go off call")
+	}
+
+	if isDoctorAOutSick && isDoctorBOutSick {
+		t.Error("write skew occurred, both doctors are out sick, but one should be on call")
+	}
+
+	if doctorA.GetError() != nil {
+		t.Errorf("got %v, want doctor-a to commit", doctorA.GetError())
+	}
+
+	if !errors.Is(doctorB.GetError(), ErrSerializationFailure) {
+		t.Errorf("got %v, want %v", doctorB.GetError(), ErrSerializationFailure)
+	}
+}
+
+func TestSerializableSnapshotIsolationForgetsFinishedTransactions(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "A")
+	table.Data["y"] = NewRow("y", "A")
+
+	longRunning := NewSerializableSnapshotIsolation("long-running", &table)
+	longRunning.Get("x")
+
+	for _, txId := range []TransactionId{"1", "2", "3"} {
+		tx := NewSerializableSnapshotIsolation(txId, &table)
+		tx.Get("x")
+		tx.Set("y", Value(txId)).Commit()
+	}
+
+	if got := len(table.rwAntidependencies.transactions); got != 4 {
+		t.Errorf("got %v, want %v", got, 4)
+	}
+
+	longRunning.Commit()
+
+	if got := len(table.rwAntidependencies.transactions); got != 0 {
+		t.Errorf("got %v, want %v", got, 0)
+	}
+
+	if got := len(table.rwAntidependencies.sireadLocks); got != 0 {
+		t.Errorf("got %v, want %v", got, 0)
+	}
+}
+
+func TestSerializableSnapshotIsolationKeepsCommittedOutOfPivot(t *testing.T) {
+	table := NewTable()
+	table.Data["x"] = NewRow("x", "A")
+	table.Data["y"] = NewRow("y", "A")
+
+	pivot := NewSerializableSnapshotIsolation("pivot", &table)
+	pivot.Get("x")
+
+	NewSerializableSnapshotIsolation("out", &table).Set("x", "B").Commit()
+
+	in := NewSerializableSnapshotIsolation("in", &table)
+	in.Get("x")
+
+	if err := pivot.Set("y", "B").Commit().GetError(); err != nil {
+		t.Fatalf("expected the pivot to commit, got error: %v", err)
+	}
+
+	in.Get("y")
+
+	if err := in.Commit().GetError(); !errors.Is(err, ErrSerializationFailure) {
+		t.Errorf("got %v, want %v", err, ErrSerializationFailure)
+	}
+}
+
+func testTakingTurnsGoingOffCall(doctorA, doctorB Transaction) {
+	isDoctorBOnCall := doctorA.Get("doctor-b-is-on-call") == "true"
+	isDoctorAOnCall := doctorB.Get("doctor-a-is-on-call") == "true"
+
+	if isDoctorBOnCall {
+		doctorA.Set("doctor-a-is-on-call", "false")
+	}
+
+	if isDoctorAOnCall {
+		doctorB.Set("doctor-b-is-on-call", "false")
+	}
+
+	doctorA.Commit()
+	doctorB.Commit()
+}